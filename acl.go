@@ -0,0 +1,252 @@
+package svalkey
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+var (
+	// ErrAccessDenied represents operation denied by Policy error
+	ErrAccessDenied = fmt.Errorf("svalkey: in Policy" +
+		" access denied")
+	// ErrPolicy represents invalid policy document error
+	ErrPolicy = fmt.Errorf("svalkey: in ParsePolicy" +
+		" policy document is invalid")
+)
+
+// Policy capabilities
+const (
+	CapRead   = "read"
+	CapWrite  = "write"
+	CapList   = "list"
+	CapDelete = "delete"
+	CapWatch  = "watch"
+)
+
+// Rule effects
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// PolicyRule allows or denies capabilities on keys matching Path.
+// Path is a glob of path.Match, trailing "**" matches any
+// number of path segments. List, DeleteTree and watch are
+// checked against their directory. List returns only values
+// readable by the identity, DeleteTree is denied if a deny rule
+// of delete capability may match a key under the directory
+type PolicyRule struct {
+	Path         string   `json:"path"`
+	Capabilities []string `json:"capabilities"`
+	// Effect is EffectAllow (default) or EffectDeny
+	Effect string `json:"effect,omitempty"`
+}
+
+// Policy holds access rules of identities. Operation is allowed
+// if a rule of the identity allows it and no rule denies it,
+// everything else is denied, including operations
+// of Store without identity. Set identity with WithIdentity
+// or Store.WithIdentity
+//
+// Policy document is JSON:
+//
+//	{"identities": {"billing": [
+//		{"path": "billing/**", "capabilities": ["read", "list"]},
+//		{"path": "billing/root", "capabilities": ["read"], "effect": "deny"}
+//	]}}
+type Policy struct {
+	Identities map[string][]*PolicyRule `json:"identities"`
+}
+
+// ParsePolicy parses and validates JSON policy document
+func ParsePolicy(data []byte) (*Policy, error) {
+	p := &Policy{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("%s; %s", ErrPolicy, err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// LoadPolicy reads and parses JSON policy document from file
+func LoadPolicy(filename string) (*Policy, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePolicy(data)
+}
+
+// Validate checks rules globs, capabilities and effects
+func (p *Policy) Validate() error {
+	for id, rules := range p.Identities {
+		for _, r := range rules {
+			if r == nil {
+				return fmt.Errorf("%s; identity %q has null rule", ErrPolicy, id)
+			}
+			if _, err := path.Match(strings.TrimSuffix(r.Path, "**"), ""); err != nil {
+				return fmt.Errorf("%s; identity %q path %q: %s", ErrPolicy, id, r.Path, err)
+			}
+			switch r.Effect {
+			case "", EffectAllow, EffectDeny:
+			default:
+				return fmt.Errorf("%s; identity %q effect %q", ErrPolicy, id, r.Effect)
+			}
+			for _, c := range r.Capabilities {
+				switch c {
+				case CapRead, CapWrite, CapList, CapDelete, CapWatch:
+				default:
+					return fmt.Errorf("%s; identity %q capability %q", ErrPolicy, id, c)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Allowed reports if identity has capability on key
+func (p *Policy) Allowed(identity, capability, key string) bool {
+	key = strings.TrimLeft(key, "/")
+	allowed := false
+	for _, r := range p.Identities[identity] {
+		if !r.has(capability) || !r.match(key) {
+			continue
+		}
+		if r.Effect == EffectDeny {
+			return false
+		}
+		allowed = true
+	}
+	return allowed
+}
+
+// deniedUnder reports if a deny rule of identity on capability
+// may match a key under directory dir
+func (p *Policy) deniedUnder(identity, capability, dir string) bool {
+	for _, r := range p.Identities[identity] {
+		if r.Effect == EffectDeny && r.has(capability) && r.overlaps(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *PolicyRule) has(capability string) bool {
+	for _, c := range r.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *PolicyRule) match(key string) bool {
+	pattern := strings.TrimLeft(r.Path, "/")
+	if strings.HasSuffix(pattern, "**") {
+		prefix := strings.TrimSuffix(pattern, "**")
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+		// match glob prefix segment by segment
+		n := strings.Count(prefix, "/")
+		parts := strings.SplitAfterN(key, "/", n+1)
+		if len(parts) <= n {
+			return false
+		}
+		ok, _ := path.Match(prefix, strings.Join(parts[:n], ""))
+		return ok
+	}
+	ok, _ := path.Match(pattern, key)
+	return ok
+}
+
+// overlaps reports if r may match a key under directory dir.
+// Path segments of r are matched against segments of dir,
+// r overlaps dir if all of them match
+func (r *PolicyRule) overlaps(dir string) bool {
+	dir = strings.Trim(dir, "/")
+	if dir == "" {
+		return true
+	}
+	segments := strings.Split(strings.TrimLeft(r.Path, "/"), "/")
+	for i, d := range strings.Split(dir, "/") {
+		if i >= len(segments) {
+			return false
+		}
+		if strings.HasSuffix(segments[i], "**") {
+			ok, _ := path.Match(strings.TrimSuffix(segments[i], "**")+"*", d)
+			return ok
+		}
+		if ok, _ := path.Match(segments[i], d); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// capability returns capability required by operation op
+func capability(op string) string {
+	switch op {
+	case OpPut, OpPutStream, OpPutMany, OpRewrap, OpImport:
+		return CapWrite
+	case OpList:
+		return CapList
+	case OpDelete, OpDeleteTree, OpDeleteMany:
+		return CapDelete
+	case OpWatch:
+		return CapWatch
+	}
+	return CapRead
+}
+
+// Interceptor returns interceptor which enforces p on operations
+// before backend calls. Identity is taken from operation context
+func (p *Policy) Interceptor() Interceptor {
+	return func(next Handler) Handler {
+		return func(op *Operation) error {
+			if op.Name == OpExport {
+				// exported keys are checked by handler after listing
+				return next(op)
+			}
+			identity := IdentityFromContext(op.Context)
+			c := capability(op.Name)
+			keys := op.Keys
+			if keys == nil {
+				keys = []string{op.Key}
+			}
+			for _, key := range keys {
+				if !p.Allowed(identity, c, key) {
+					return ErrAccessDenied
+				}
+			}
+			if op.Name == OpDeleteTree && p.deniedUnder(identity, CapDelete, op.Key) {
+				return ErrAccessDenied
+			}
+			return next(op)
+		}
+	}
+}
+
+// readable reports if identity of ctx may read key. It checks
+// keys which are known only after the backend call
+func (s *Store) readable(ctx context.Context, key string) bool {
+	return s.policy == nil || s.policy.Allowed(IdentityFromContext(ctx), CapRead, key)
+}
+
+// SetPolicy enforces p on operations of s before interceptors
+// set by Use, see Policy. Nil p disables access control
+func (s *Store) SetPolicy(p *Policy) {
+	s.policy = p
+}
+
+// WithIdentity returns a copy of s bound to identity,
+// which is checked by Policy and written to audit records
+func (s *Store) WithIdentity(identity string) *Store {
+	return s.WithContext(WithIdentity(s.context(), identity))
+}
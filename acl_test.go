@@ -0,0 +1,183 @@
+package svalkey
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testPolicy = `{"identities": {
+	"billing": [
+		{"path": "billing/**", "capabilities": ["read", "write", "list", "delete"]},
+		{"path": "billing/root", "capabilities": ["read", "write"], "effect": "deny"},
+		{"path": "shared/*", "capabilities": ["read"]},
+		{"path": "billing/locked/*", "capabilities": ["delete"], "effect": "deny"}
+	],
+	"ops": [
+		{"path": "*/config", "capabilities": ["read"]}
+	]
+}}`
+
+func TestPolicy_Allowed(t *testing.T) {
+	p, err := ParsePolicy([]byte(testPolicy))
+	assert.Nil(t, err, "Err in ParsePolicy must be nil")
+	tests := []struct {
+		identity, capability, key string
+		allowed                   bool
+	}{
+		{"billing", CapRead, "billing/a", true},
+		{"billing", CapRead, "/billing/a/b", true},
+		{"billing", CapWrite, "billing/root", false},
+		{"billing", CapDelete, "billing/root", true},
+		{"billing", CapDelete, "billing/locked/a", false},
+		{"billing", CapRead, "shared/a", true},
+		{"billing", CapWrite, "shared/a", false},
+		{"billing", CapRead, "shared/a/b", false},
+		{"billing", CapRead, "payroll/a", false},
+		{"billing", CapWatch, "billing/a", false},
+		{"ops", CapRead, "billing/config", true},
+		{"ops", CapRead, "billing/a", false},
+		{"", CapRead, "billing/a", false},
+		{"unknown", CapRead, "shared/a", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.allowed, p.Allowed(tt.identity, tt.capability, tt.key),
+			"Allowed(%q, %q, %q)", tt.identity, tt.capability, tt.key)
+	}
+
+	for _, doc := range []string{
+		`{"identities": {"a": [{"path": "[", "capabilities": ["read"]}]}}`,
+		`{"identities": {"a": [{"path": "a", "capabilities": ["admin"]}]}}`,
+		`{"identities": {"a": [{"path": "a", "capabilities": ["read"], "effect": "maybe"}]}}`,
+		`{"identities": []}`,
+	} {
+		_, err := ParsePolicy([]byte(doc))
+		assert.NotNil(t, err, "Err in ParsePolicy must not be nil for %s", doc)
+	}
+}
+
+func TestStore_Policy(t *testing.T) {
+	st, err := NewCustomStore(NewMock(), JSONCodec{}, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	assert.Nil(t, st.Put("billing/root", TestType{C: "root"}, nil), "Err in Put must be nil")
+	p, err := ParsePolicy([]byte(testPolicy))
+	assert.Nil(t, err, "Err in ParsePolicy must be nil")
+	st.SetPolicy(p)
+
+	out := TestType{}
+	assert.Equal(t, ErrAccessDenied, st.Get("billing/root", &out, nil),
+		"Store without identity must be denied")
+
+	billing := st.WithIdentity("billing")
+	assert.Nil(t, billing.Put("billing/a", TestType{C: "a"}, nil), "Err in Put must be nil")
+	assert.Nil(t, billing.Get("billing/a", &out, nil), "Err in Get must be nil")
+	assert.Equal(t, "a", out.C, "Get must return put value")
+	assert.Equal(t, ErrAccessDenied, billing.Get("billing/root", &out, nil),
+		"Get of denied key must fail")
+	list := []TestType{}
+	pairs, err := billing.List("billing/", &list, nil)
+	assert.Nil(t, err, "Err in List must be nil")
+	assert.Equal(t, 1, len(pairs), "List must leave out not readable values")
+	assert.Equal(t, "billing/a", pairs[0].Key(), "List must return readable values")
+	assert.Equal(t, ErrAccessDenied, billing.DeleteTree("billing/"),
+		"DeleteTree of directory with denied keys must fail")
+	assert.Equal(t, ErrAccessDenied, billing.DeleteTree("billing/locked"),
+		"DeleteTree of denied directory must fail")
+	_, err = billing.List("shared/", &list, nil)
+	assert.Equal(t, ErrAccessDenied, err, "List of not allowed directory must fail")
+	assert.Equal(t, ErrAccessDenied,
+		billing.PutMany(map[string]interface{}{"billing/b": TestType{}, "payroll/b": TestType{}}, nil),
+		"PutMany must fail if any key is denied")
+	ok, err := billing.Exists("billing/b", nil)
+	assert.Nil(t, err, "Err in Exists must be nil")
+	assert.False(t, ok, "Denied PutMany must not write any key")
+	_, err = NewCachedStore(billing, &CacheOptions{Watch: "billing/"})
+	assert.Equal(t, ErrAccessDenied, err, "Watch without capability must fail")
+	assert.Equal(t, ErrClassDenied, ErrorClass(ErrAccessDenied), "ErrAccessDenied class must be denied")
+
+	st.SetPolicy(nil)
+	assert.Nil(t, st.Get("billing/root", &out, nil), "Err in Get must be nil without policy")
+	st.SetPolicy(p)
+	assert.Nil(t, billing.DeleteTree("billing/other/"), "Err in DeleteTree must be nil")
+}
+
+func TestStore_PolicyInternalWrites(t *testing.T) {
+	Register(TestType{})
+	p, err := ParsePolicy([]byte(`{"identities": {
+		"billing": [{"path": "billing/**", "capabilities": ["read", "write"]}],
+		"reader": [{"path": "users/**", "capabilities": ["read"]}]
+	}}`))
+	assert.Nil(t, err, "Err in ParsePolicy must be nil")
+
+	m := rewriteMock{NewMock()}
+	codec, err := NewPrimedCodec(GobCodec{}, TestType{})
+	assert.Nil(t, err, "Err in NewPrimedCodec must be nil")
+	st, err := NewCustomStore(m, codec, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	st.SetPolicy(p)
+	assert.Nil(t, st.WithIdentity("billing").Put("billing/a", TestType{C: "a"}, nil),
+		"Put through primed codec must not be checked against primer key")
+	reader, err := NewCustomStore(m, GobCodec{}, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	reader.SetPolicy(p)
+	out := TestType{}
+	assert.Nil(t, reader.WithIdentity("billing").Get("billing/a", &out, nil),
+		"Get through primed codec must not be checked against primer key")
+	assert.Equal(t, "a", out.C, "Get must return put value")
+
+	js, err := NewJSONStore(m, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewJSONStore must be nil")
+	assert.Nil(t, js.Put("users/1", userV1{"John Admin"}, nil), "Err in Put must be nil")
+	js.SetPolicy(p)
+	js.SetMigrationWriteBack(true)
+	u := userV2{}
+	assert.Nil(t, js.WithIdentity("reader").Get("users/1", &u, nil),
+		"Get with write back must be allowed to read-only identity")
+	assert.Equal(t, userV2{"John", "Admin", true}, u)
+	assert.Equal(t, ErrAccessDenied, js.WithIdentity("reader").Put("users/1", u, nil),
+		"Put of read-only identity must be denied")
+}
+
+func TestStore_PolicyBulk(t *testing.T) {
+	p, err := ParsePolicy([]byte(`{"identities": {
+		"backup": [{"path": "**", "capabilities": ["read"]}],
+		"admin": [{"path": "**", "capabilities": ["read", "write"]}],
+		"billing": [{"path": "billing/**", "capabilities": ["read", "write"]}]
+	}}`))
+	assert.Nil(t, err, "Err in ParsePolicy must be nil")
+	st, err := NewJSONStore(NewMock(), []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewJSONStore must be nil")
+	assert.Nil(t, st.Put("billing/a", TestType{C: "a"}, nil), "Err in Put must be nil")
+	assert.Nil(t, st.Put("users/a", TestType{C: "a"}, nil), "Err in Put must be nil")
+	st.SetPolicy(p)
+	backup, billing := st.WithIdentity("backup"), st.WithIdentity("billing")
+	admin := st.WithIdentity("admin")
+
+	var buf bytes.Buffer
+	assert.Equal(t, ErrAccessDenied, billing.Export("", &buf, nil),
+		"Export of not readable keys must be denied")
+	assert.Nil(t, backup.Export("", &buf, nil), "Err in Export must be nil")
+	data := buf.Bytes()
+	_, err = backup.Import(bytes.NewReader(data), &ImportOptions{DryRun: true})
+	assert.Equal(t, ErrAccessDenied, err, "Import without write capability must be denied")
+	_, err = admin.Import(bytes.NewReader(data), &ImportOptions{DryRun: true})
+	assert.Nil(t, err, "Err in Import must be nil")
+
+	_, err = billing.Verify("", nil)
+	assert.Equal(t, ErrAccessDenied, err, "Verify of not readable keys must be denied")
+	rep, err := backup.Verify("", nil)
+	assert.Nil(t, err, "Err in Verify must be nil")
+	assert.True(t, rep.OK(), "Verify must succeed")
+
+	dst, err := NewJSONStore(NewMock(), []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewJSONStore must be nil")
+	dst.SetPolicy(p)
+	_, err = Migrate(billing, dst.WithIdentity("admin"), "", nil)
+	assert.Equal(t, ErrAccessDenied, err, "Migrate of not readable keys must be denied")
+	_, err = Migrate(backup, dst.WithIdentity("backup"), "", nil)
+	assert.Equal(t, ErrAccessDenied, err, "Migrate without write capability must be denied")
+	rep2, err := Migrate(backup, dst.WithIdentity("admin"), "", nil)
+	assert.Nil(t, err, "Err in Migrate must be nil")
+	assert.Equal(t, []string{"billing/a", "users/a"}, rep2.Copied)
+}
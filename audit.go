@@ -0,0 +1,297 @@
+package svalkey
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/abronan/valkeyrie/store"
+)
+
+var (
+	// ErrAuditChain represents broken hash chain of audit log error
+	ErrAuditChain = fmt.Errorf("svalkey: in VerifyAuditLog" +
+		" hash chain is broken")
+)
+
+// Audit outcomes
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// AuditRecord describes one Store operation on one key
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	Operation string    `json:"op"`
+	// Key is the key or directory of the operation,
+	// or its HMAC if AuditOptions.HashKeys is set. HMAC is
+	// empty in records of operations on closed Store
+	Key      string `json:"key"`
+	Identity string `json:"identity,omitempty"`
+	Outcome  string `json:"outcome"`
+	// ErrorClass is the class of the operation error,
+	// see ErrorClass
+	ErrorClass string `json:"error_class,omitempty"`
+}
+
+// AuditSink receives audit records of Store operations.
+// Implementations must be safe for concurrent use
+type AuditSink interface {
+	Audit(r *AuditRecord) error
+}
+
+// AuditOptions holds audit settings
+type AuditOptions struct {
+	// HashKeys replaces keys in records with their hex encoded
+	// HMAC-SHA256 under a key derived from the Store key,
+	// see Store.AuditKey
+	HashKeys bool
+	// OnError is called with sink errors, they are ignored if it is nil
+	OnError func(err error)
+}
+
+type auditor struct {
+	sink AuditSink
+	opts AuditOptions
+}
+
+type identityKey struct{}
+
+// WithIdentity returns context which carries caller identity
+// written to audit records of Store bound to it with WithContext
+func WithIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext returns caller identity set by WithIdentity
+func IdentityFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(identityKey{}).(string)
+	return id
+}
+
+// SetAuditSink sets sink which receives a record for every key
+// of every Store operation. Nil sink disables audit
+func (s *Store) SetAuditSink(sink AuditSink, opts *AuditOptions) {
+	if sink == nil {
+		s.auditor = nil
+		return
+	}
+	a := &auditor{sink: sink}
+	if opts != nil {
+		a.opts = *opts
+	}
+	s.auditor = a
+}
+
+// AuditKey returns the key as it is written to audit records
+// with AuditOptions.HashKeys set, empty string if Store is closed
+func (s *Store) AuditKey(key string) string {
+	if s.keyBuf.acquire() != nil {
+		return ""
+	}
+	defer s.keyBuf.release()
+	return s.auditKey(key)
+}
+
+func (s *Store) auditKey(key string) string {
+	akey := s.subKey("svalkey audit key")
+	defer zeroBytes(akey)
+	mac := hmac.New(sha256.New, akey)
+	mac.Write([]byte(key))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// audit writes records of operation op on keys. Keys of BatchError
+// get their own errors, other keys succeed. ErrStoreClosed is
+// returned before the key is acquired, keys are not hashed then
+// as the key is zeroed
+func (s *Store) audit(start time.Time, op string, keys []string, err error) {
+	a := s.auditor
+	if a == nil {
+		return
+	}
+	identity := IdentityFromContext(s.context())
+	be, batch := err.(*BatchError)
+	for _, key := range keys {
+		kerr := err
+		if batch {
+			kerr = be.Errors[key]
+		}
+		r := &AuditRecord{
+			Time:       start.UTC(),
+			Operation:  op,
+			Key:        key,
+			Identity:   identity,
+			Outcome:    AuditSuccess,
+			ErrorClass: ErrorClass(kerr),
+		}
+		if kerr != nil {
+			r.Outcome = AuditFailure
+		}
+		if a.opts.HashKeys {
+			r.Key = ""
+			if err != ErrStoreClosed {
+				r.Key = s.auditKey(key)
+			}
+		}
+		if err := a.sink.Audit(r); err != nil && a.opts.OnError != nil {
+			a.opts.OnError(err)
+		}
+	}
+}
+
+// Error classes
+const (
+	ErrClassNotFound       = "not-found"
+	ErrClassConflict       = "conflict"
+	ErrClassAuthentication = "authentication"
+	ErrClassCorrupted      = "corrupted"
+	ErrClassInvalid        = "invalid-argument"
+	ErrClassBatch          = "batch"
+	ErrClassDenied         = "access-denied"
+	ErrClassOther          = "other"
+)
+
+// ErrorClass returns the class of err returned by Store,
+// empty string for nil err
+func ErrorClass(err error) string {
+	switch err {
+	case nil:
+		return ""
+	case store.ErrKeyNotFound:
+		return ErrClassNotFound
+	case store.ErrKeyModified, store.ErrKeyExists:
+		return ErrClassConflict
+	case ErrAuthentication, ErrManifestCorrupted, ErrChunkCorrupted,
+		ErrNotRecipient, ErrNoPrivateKey:
+		return ErrClassAuthentication
+	case ErrEnvelope, ErrChunkMissing, ErrPrimerNotFound, ErrSchemaVersion:
+		return ErrClassCorrupted
+	case ErrorNilValue, ErrorInvalidUnmarshal, ErrorInvalidOutPointer,
+		ErrorInvalidOutSlice, ErrInvalidPath, ErrNoRecipients:
+		return ErrClassInvalid
+	case ErrAccessDenied, ErrOutOfScope, ErrWriteOnly:
+		return ErrClassDenied
+	}
+	if _, ok := err.(*BatchError); ok {
+		return ErrClassBatch
+	}
+	return ErrClassOther
+}
+
+// FileAuditSink writes audit records to a file as JSON lines.
+// Every line holds SHA-256 hash of the previous line, so modified,
+// reordered or removed lines are detected by VerifyAuditLog.
+// Removal of the latest lines is detected only by comparing
+// the last hash with Head saved elsewhere
+type FileAuditSink struct {
+	sync.Mutex
+	f    *os.File
+	prev string
+}
+
+// auditLine is a record line of FileAuditSink. Hash is SHA-256
+// of the line marshaled with empty Hash
+type auditLine struct {
+	AuditRecord
+	Prev string `json:"prev"`
+	Hash string `json:"hash,omitempty"`
+}
+
+func (l *auditLine) hash() (string, error) {
+	c := *l
+	c.Hash = ""
+	data, err := json.Marshal(&c)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// NewFileAuditSink opens or creates audit log at path.
+// Records are appended continuing the hash chain of the log,
+// ErrAuditChain is returned if the chain is already broken
+func NewFileAuditSink(path string) (*FileAuditSink, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	_, last, err := scanAuditLog(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &FileAuditSink{f: f, prev: last}, nil
+}
+
+// Audit appends r to the log
+func (s *FileAuditSink) Audit(r *AuditRecord) error {
+	s.Lock()
+	defer s.Unlock()
+	l := &auditLine{AuditRecord: *r, Prev: s.prev}
+	h, err := l.hash()
+	if err != nil {
+		return err
+	}
+	l.Hash = h
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	if _, err := s.f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	s.prev = h
+	return nil
+}
+
+// Head returns hash of the last record
+func (s *FileAuditSink) Head() string {
+	s.Lock()
+	defer s.Unlock()
+	return s.prev
+}
+
+// Close closes the log file
+func (s *FileAuditSink) Close() error {
+	s.Lock()
+	defer s.Unlock()
+	return s.f.Close()
+}
+
+// VerifyAuditLog checks hash chain of audit log written
+// by FileAuditSink. It returns the number of valid records
+func VerifyAuditLog(r io.Reader) (int, error) {
+	n, _, err := scanAuditLog(r)
+	return n, err
+}
+
+// scanAuditLog verifies log and returns the number
+// of its records and hash of the last one
+func scanAuditLog(r io.Reader) (n int, last string, err error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		l := &auditLine{}
+		if err := json.Unmarshal(sc.Bytes(), l); err != nil {
+			return n, last, ErrAuditChain
+		}
+		h, err := l.hash()
+		if err != nil || l.Prev != last || h != l.Hash {
+			return n, last, ErrAuditChain
+		}
+		last = l.Hash
+		n++
+	}
+	return n, last, sc.Err()
+}
@@ -0,0 +1,108 @@
+package svalkey
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/abronan/valkeyrie/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore_Audit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "svalkey")
+	assert.Nil(t, err, "Err in TempDir must be nil")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+	sink, err := NewFileAuditSink(path)
+	assert.Nil(t, err, "Err in NewFileAuditSink must be nil")
+
+	st, err := NewCustomStore(rewriteMock{NewMock()}, JSONCodec{}, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	st.SetAuditSink(sink, nil)
+	ast := st.WithContext(WithIdentity(context.Background(), "alice"))
+
+	assert.Nil(t, ast.Put("a", TestType{C: "a"}, nil), "Err in Put must be nil")
+	out := TestType{}
+	assert.Nil(t, ast.Get("a", &out, nil), "Err in Get must be nil")
+	assert.NotNil(t, st.Get("b", &out, nil), "Err in Get must not be nil")
+	err = ast.GetMany([]string{"a", "b"}, &[]TestType{}, nil)
+	assert.NotNil(t, err, "Err in GetMany must not be nil")
+	assert.Nil(t, sink.Close(), "Err in Close must be nil")
+
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(t, err, "Err in ReadFile must be nil")
+	n, err := VerifyAuditLog(bytes.NewReader(data))
+	assert.Nil(t, err, "Err in VerifyAuditLog must be nil")
+	assert.Equal(t, 5, n)
+
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	recs := make([]auditLine, len(lines))
+	for i, l := range lines {
+		assert.Nil(t, json.Unmarshal(l, &recs[i]), "Err in Unmarshal must be nil")
+	}
+	assert.Equal(t, AuditRecord{Time: recs[0].Time, Operation: "put", Key: "a",
+		Identity: "alice", Outcome: AuditSuccess}, recs[0].AuditRecord)
+	assert.Equal(t, "get", recs[1].Operation)
+	assert.Equal(t, "", recs[2].Identity, "Store without context must have no identity")
+	assert.Equal(t, AuditFailure, recs[2].Outcome)
+	assert.Equal(t, ErrClassNotFound, recs[2].ErrorClass, "Not found error must be classified")
+	assert.Equal(t, "get_many", recs[3].Operation)
+	assert.Equal(t, AuditSuccess, recs[3].Outcome, "Batch key must get its own outcome")
+	assert.Equal(t, AuditFailure, recs[4].Outcome, "Batch key must get its own outcome")
+
+	// Modified record breaks the chain
+	tampered := bytes.Replace(data, []byte(`"op":"put"`), []byte(`"op":"get"`), 1)
+	n, err = VerifyAuditLog(bytes.NewReader(tampered))
+	assert.Equal(t, ErrAuditChain, err)
+	assert.Equal(t, 0, n)
+	// Removed record breaks the chain
+	removed := bytes.Join(append(lines[:1:1], lines[2:]...), []byte("\n"))
+	n, err = VerifyAuditLog(bytes.NewReader(removed))
+	assert.Equal(t, ErrAuditChain, err)
+	assert.Equal(t, 1, n)
+
+	// Reopened sink continues the chain
+	sink, err = NewFileAuditSink(path)
+	assert.Nil(t, err, "Err in NewFileAuditSink must be nil")
+	st.SetAuditSink(sink, &AuditOptions{HashKeys: true})
+	assert.Nil(t, st.Delete("a"), "Err in Delete must be nil")
+	head := sink.Head()
+	assert.Nil(t, sink.Close(), "Err in Close must be nil")
+	data, _ = ioutil.ReadFile(path)
+	n, err = VerifyAuditLog(bytes.NewReader(data))
+	assert.Nil(t, err, "Err in VerifyAuditLog must be nil")
+	assert.Equal(t, 6, n)
+	last := auditLine{}
+	lines = bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	assert.Nil(t, json.Unmarshal(lines[5], &last), "Err in Unmarshal must be nil")
+	assert.Equal(t, st.AuditKey("a"), last.Key, "Key must be hashed")
+	assert.Equal(t, head, last.Hash)
+}
+
+func TestStore_AuditClosed(t *testing.T) {
+	st, err := NewCustomStore(NewMock(), JSONCodec{}, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	rec := &recordAudit{}
+	st.SetAuditSink(rec, &AuditOptions{HashKeys: true})
+	st.Close()
+
+	assert.Equal(t, ErrStoreClosed, st.Get("a", &TestType{}, nil))
+	assert.Equal(t, 1, len(rec.records), "Operation on closed Store must be audited")
+	assert.Equal(t, AuditFailure, rec.records[0].Outcome)
+	assert.Equal(t, "", rec.records[0].Key, "Key must not be hashed with zeroed key")
+	assert.Equal(t, "", st.AuditKey("a"), "AuditKey of closed Store must be empty")
+}
+
+func TestErrorClass(t *testing.T) {
+	assert.Equal(t, "", ErrorClass(nil))
+	assert.Equal(t, ErrClassNotFound, ErrorClass(store.ErrKeyNotFound))
+	assert.Equal(t, ErrClassAuthentication, ErrorClass(ErrAuthentication))
+	assert.Equal(t, ErrClassCorrupted, ErrorClass(ErrEnvelope))
+	assert.Equal(t, ErrClassInvalid, ErrorClass(ErrorNilValue))
+	assert.Equal(t, ErrClassBatch, ErrorClass(&BatchError{}))
+}
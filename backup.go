@@ -0,0 +1,326 @@
+package svalkey
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/abronan/valkeyrie/store"
+)
+
+// archiveMagic prefixes export archives
+var archiveMagic = []byte("SVKARC01")
+
+// Archive payload modes
+const (
+	archivePlain    byte = 0x00
+	archivePassword byte = 0x01
+)
+
+var (
+	// ErrArchiveCorrupted represents export archive integrity error
+	ErrArchiveCorrupted = fmt.Errorf("svalkey: in Import" +
+		" archive failed integrity check")
+	// ErrArchivePassword represents missing archive password error
+	ErrArchivePassword = fmt.Errorf("svalkey: in Import" +
+		" archive is encrypted, password is needed")
+	// ErrImportConflict represents existing key error with ConflictFail policy
+	ErrImportConflict = fmt.Errorf("svalkey: in Import" +
+		" key already exists")
+)
+
+// ConflictPolicy defines Import behavior for existing keys
+type ConflictPolicy int
+
+const (
+	// ConflictSkip keeps existing values
+	ConflictSkip ConflictPolicy = iota
+	// ConflictOverwrite replaces existing values
+	ConflictOverwrite
+	// ConflictFail aborts import before anything is written
+	ConflictFail
+)
+
+// ExportOptions holds Export settings
+type ExportOptions struct {
+	// Password re-encrypts the archive using EncryptData
+	Password []byte
+}
+
+// ImportOptions holds Import settings
+type ImportOptions struct {
+	// Password decrypts the archive exported with password
+	Password []byte
+	// Conflict defines what to do with existing keys
+	Conflict ConflictPolicy
+	// DryRun reports what would be imported without writing
+	DryRun bool
+}
+
+// ImportResult holds keys of imported values
+type ImportResult struct {
+	Imported []string `json:"imported"`
+	Skipped  []string `json:"skipped"`
+}
+
+// archive holds exported entries. Values are stored in the backend
+// format, so they stay encrypted with the Store key
+type archive struct {
+	Version int            `json:"version"`
+	Prefix  string         `json:"prefix"`
+	Created time.Time      `json:"created"`
+	Entries []archiveEntry `json:"entries"`
+}
+
+type archiveEntry struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// Export writes all values under prefix into w.
+//
+// The archive layout is:
+//
+//	magic | mode | payload | HMAC
+//	  8      1       n       32
+//
+// Payload holds JSON encoded entries, it is encrypted with
+// EncryptData if a password is set. Values stay encrypted with
+// the Store key, so Import must use the same key. HMAC is made
+// with a key derived from the Store key. Chunks of values and
+// primers of primed codecs are exported too.
+//
+// Export runs as OpExport operation on prefix. Keys are known
+// only after listing, so Policy read capability is checked
+// on every exported value in the handler
+func (s *Store) Export(prefix string, w io.Writer, opts *ExportOptions) error {
+	if opts == nil {
+		opts = &ExportOptions{}
+	}
+	prefix, err := s.scope(prefix)
+	if err != nil {
+		return err
+	}
+	return s.run(&Operation{Name: OpExport, Key: prefix}, func(op *Operation) error {
+		arc, err := s.exportArchive(op, prefix)
+		if err != nil {
+			return err
+		}
+		payload, err := json.Marshal(arc)
+		if err != nil {
+			return fmt.Errorf("svalkey: error export encode; %s", err.Error())
+		}
+		mode := archivePlain
+		if len(opts.Password) > 0 {
+			mode = archivePassword
+			if payload, err = EncryptData(opts.Password, payload); err != nil {
+				return fmt.Errorf("svalkey: error export encrypt; %s", err.Error())
+			}
+		}
+		data := append(append(append([]byte{}, archiveMagic...), mode), payload...)
+		data = append(data, s.archiveMAC(data)...)
+		_, err = w.Write(data)
+		return err
+	})
+}
+
+// exportArchive lists values under prefix and primers
+// of s into archive
+func (s *Store) exportArchive(op *Operation, prefix string) (*archive, error) {
+	primersDir := s.prefix + primersDir
+	arc := &archive{Version: 1, Prefix: prefix, Created: time.Now().UTC()}
+	seen := map[string]bool{}
+	for _, dir := range []string{prefix, primersDir} {
+		if dir == primersDir && strings.HasPrefix(primersDir, prefix) {
+			continue
+		}
+		pairs, err := s.list(dir, nil)
+		if err != nil {
+			if err == store.ErrKeyNotFound {
+				continue
+			}
+			return nil, err
+		}
+		for _, p := range pairs {
+			if seen[p.Key] {
+				continue
+			}
+			if !isChunkKey(p.Key) && !isReservedKey(p.Key) && !s.readable(op.Context, p.Key) {
+				return nil, ErrAccessDenied
+			}
+			seen[p.Key] = true
+			arc.Entries = append(arc.Entries, archiveEntry{p.Key, p.Value})
+		}
+	}
+	return arc, nil
+}
+
+// Import puts values from archive written by Export. It runs
+// as OpImport operation with the keys of archived values, so
+// Policy requires write capability on every one of them
+func (s *Store) Import(r io.Reader, opts *ImportOptions) (*ImportResult, error) {
+	if opts == nil {
+		opts = &ImportOptions{}
+	}
+	if err := s.keyBuf.acquire(); err != nil {
+		return nil, err
+	}
+	arc, err := s.readArchive(r, opts.Password)
+	s.keyBuf.release()
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for _, e := range arc.Entries {
+		if !s.inScope(e.Key) {
+			return nil, ErrOutOfScope
+		}
+		if !isChunkKey(e.Key) && !isReservedKey(e.Key) {
+			keys = append(keys, e.Key)
+		}
+	}
+	var res *ImportResult
+	err = s.run(&Operation{Name: OpImport, Keys: keys}, func(op *Operation) (err error) {
+		res, err = s.importArchive(arc, opts)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *Store) importArchive(arc *archive, opts *ImportOptions) (*ImportResult, error) {
+	res := &ImportResult{Imported: []string{}, Skipped: []string{}}
+	skip := map[string]bool{}
+	for _, e := range arc.Entries {
+		if isChunkKey(e.Key) || isReservedKey(e.Key) {
+			continue
+		}
+		ok, err := s.exists(e.Key, nil)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case !ok || opts.Conflict == ConflictOverwrite:
+			res.Imported = append(res.Imported, e.Key)
+		case opts.Conflict == ConflictFail:
+			return nil, fmt.Errorf("%s; key: '%s'", ErrImportConflict.Error(), e.Key)
+		default:
+			res.Skipped = append(res.Skipped, e.Key)
+			skip[e.Key] = true
+		}
+	}
+	if opts.DryRun {
+		return res, nil
+	}
+	var err error
+	for _, e := range arc.Entries {
+		switch {
+		case isReservedKey(e.Key):
+			err = s.importReserved(e)
+		case skip[chunkParent(e.Key)]:
+		case isChunkKey(e.Key):
+			err = s.putRaw("put_chunk", e)
+		default:
+			err = s.importValue(e)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// importReserved puts archived internal entry if it doesn't exist.
+// Primers are content addressed, so existing ones are equal
+func (s *Store) importReserved(e archiveEntry) error {
+	ok, err := s.exists(e.Key, nil)
+	if err != nil || ok {
+		return err
+	}
+	return s.putRaw("put", e)
+}
+
+// importValue puts archived value removing stale chunks
+// of the overwritten value
+func (s *Store) importValue(e archiveEntry) error {
+	defer s.changes.changed(e.Key)
+	old, err := s.storedManifest(e.Key)
+	if err != nil {
+		return err
+	}
+	if err := s.putRaw("put", e); err != nil {
+		return err
+	}
+	var cur *manifest
+	if isManifest(e.Value) {
+		cur, _ = s.unmarshalManifest(e.Key, e.Value)
+	}
+	return s.deleteChunks(e.Key, old, cur)
+}
+
+// putRaw writes archived entry verbatim. Values are stored
+// in backend format, so they don't go through put, which
+// would split them into chunks again
+func (s *Store) putRaw(name string, e archiveEntry) error {
+	return s.backend(name, false, func() error {
+		return s.Store.Put(e.Key, e.Value, nil)
+	})
+}
+
+func (s *Store) readArchive(r io.Reader, password []byte) (*archive, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < len(archiveMagic)+1+sha256.Size ||
+		!bytes.Equal(data[:len(archiveMagic)], archiveMagic) {
+		return nil, ErrArchiveCorrupted
+	}
+	body, mac := data[:len(data)-sha256.Size], data[len(data)-sha256.Size:]
+	if !hmac.Equal(mac, s.archiveMAC(body)) {
+		return nil, ErrArchiveCorrupted
+	}
+	mode, payload := body[len(archiveMagic)], body[len(archiveMagic)+1:]
+	switch mode {
+	case archivePlain:
+	case archivePassword:
+		if len(password) == 0 {
+			return nil, ErrArchivePassword
+		}
+		payload, err = DecryptData(password, bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Errorf("svalkey: error import decrypt; %s", err.Error())
+		}
+	default:
+		return nil, ErrArchiveCorrupted
+	}
+	arc := &archive{}
+	if err := json.Unmarshal(payload, arc); err != nil {
+		return nil, fmt.Errorf("svalkey: error import decode; %s", err.Error())
+	}
+	return arc, nil
+}
+
+func (s *Store) archiveMAC(data []byte) []byte {
+	mkey := s.subKey("svalkey export archive")
+	defer zeroBytes(mkey)
+	mac := hmac.New(sha256.New, mkey)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// chunkParent returns key of the value which chunk key belongs to
+func chunkParent(key string) string {
+	if i := strings.Index(key, chunksDir); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
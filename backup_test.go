@@ -0,0 +1,84 @@
+package svalkey
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newBackupStores(t *testing.T) (*Store, *Store, *Mock) {
+	src, _ := newChunkedStore(t)
+	assert.Nil(t, src.Put("app/a", []byte("value a"), nil), "Err in Put must be nil")
+	assert.Nil(t, src.Put("app/b", bytes.Repeat([]byte("b"), 2000), nil), "Err in Put must be nil")
+
+	m := NewMock()
+	dst, err := NewCustomStore(rewriteMock{m}, JSONCodec{}, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	return src, dst, m
+}
+
+func TestStore_ExportImport(t *testing.T) {
+	src, dst, m := newBackupStores(t)
+
+	buf := bytes.Buffer{}
+	err := src.Export("app", &buf, nil)
+	assert.Nil(t, err, "Err in Export must be nil")
+
+	res, err := dst.Import(bytes.NewReader(buf.Bytes()), &ImportOptions{DryRun: true})
+	assert.Nil(t, err, "Err in Import must be nil")
+	assert.ElementsMatch(t, []string{"app/a", "app/b"}, res.Imported)
+	assert.Empty(t, m.kv, "Dry run must not write values")
+
+	res, err = dst.Import(bytes.NewReader(buf.Bytes()), nil)
+	assert.Nil(t, err, "Err in Import must be nil")
+	assert.ElementsMatch(t, []string{"app/a", "app/b"}, res.Imported)
+	out := []byte{}
+	assert.Nil(t, dst.Get("app/b", &out, nil), "Err in Get must be nil")
+	assert.Equal(t, bytes.Repeat([]byte("b"), 2000), out)
+
+	res, err = dst.Import(bytes.NewReader(buf.Bytes()), &ImportOptions{Conflict: ConflictSkip})
+	assert.Nil(t, err, "Err in Import must be nil")
+	assert.Empty(t, res.Imported)
+	assert.ElementsMatch(t, []string{"app/a", "app/b"}, res.Skipped)
+
+	_, err = dst.Import(bytes.NewReader(buf.Bytes()), &ImportOptions{Conflict: ConflictFail})
+	assert.NotNil(t, err, "Err in Import with ConflictFail must not be nil")
+	assert.True(t, strings.HasPrefix(err.Error(), ErrImportConflict.Error()))
+
+	assert.Nil(t, dst.Put("app/a", []byte("changed"), nil), "Err in Put must be nil")
+	res, err = dst.Import(bytes.NewReader(buf.Bytes()), &ImportOptions{Conflict: ConflictOverwrite})
+	assert.Nil(t, err, "Err in Import must be nil")
+	assert.Nil(t, dst.Get("app/a", &out, nil), "Err in Get must be nil")
+	assert.Equal(t, []byte("value a"), out)
+
+	data := buf.Bytes()
+	data[len(data)/2] ^= 0xff
+	_, err = dst.Import(bytes.NewReader(data), nil)
+	assert.Equal(t, ErrArchiveCorrupted, err)
+}
+
+func TestStore_ExportImportPassword(t *testing.T) {
+	src, dst, _ := newBackupStores(t)
+
+	buf := bytes.Buffer{}
+	err := src.Export("", &buf, &ExportOptions{Password: []byte("backup password")})
+	assert.Nil(t, err, "Err in Export must be nil")
+	assert.False(t, bytes.Contains(buf.Bytes(), []byte("app/a")),
+		"Archive with password must not reveal keys")
+
+	_, err = dst.Import(bytes.NewReader(buf.Bytes()), nil)
+	assert.Equal(t, ErrArchivePassword, err)
+	_, err = dst.Import(bytes.NewReader(buf.Bytes()),
+		&ImportOptions{Password: []byte("wrong password")})
+	assert.NotNil(t, err, "Err in Import with wrong password must not be nil")
+
+	res, err := dst.Import(bytes.NewReader(buf.Bytes()),
+		&ImportOptions{Password: []byte("backup password")})
+	assert.Nil(t, err, "Err in Import must be nil")
+	assert.ElementsMatch(t, []string{"app/a", "app/b"}, res.Imported)
+	out := []byte{}
+	assert.Nil(t, dst.Get("app/a", &out, nil), "Err in Get must be nil")
+	assert.Equal(t, []byte("value a"), out)
+}
@@ -0,0 +1,319 @@
+package svalkey
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/abronan/valkeyrie/store"
+)
+
+// DefaultBatchConcurrency is the number of concurrent backend
+// calls of batch operations if BatchOptions.Concurrency is not set
+const DefaultBatchConcurrency = 8
+
+// BatchStore is an extension point for backends which can read,
+// write and delete several keys in one call or transaction.
+// Valkeyrie backends don't implement it, wrap the backend passed
+// to NewCustomStore to add it. Batch operations of Store use it
+// if the backend implements it, otherwise they call the backend
+// for every key concurrently
+type BatchStore interface {
+	// GetMany returns pairs of existing keys
+	GetMany(keys []string, options *store.ReadOptions) ([]*store.KVPair, error)
+	// PutMany writes all pairs or none of them
+	PutMany(pairs []*store.KVPair, options *store.WriteOptions) error
+	// DeleteMany deletes all keys or none of them
+	DeleteMany(keys []string) error
+}
+
+// BatchOptions holds settings of batch operations
+type BatchOptions struct {
+	// Concurrency is the number of concurrent backend calls,
+	// default is DefaultBatchConcurrency
+	Concurrency int
+	// Workers is the number of values en/decrypted concurrently,
+	// default is the number of CPUs
+	Workers      int
+	ReadOptions  *store.ReadOptions
+	WriteOptions *store.WriteOptions
+}
+
+// BatchError holds errors of keys failed in batch operation
+type BatchError struct {
+	Errors map[string]error
+}
+
+func (e *BatchError) Error() string {
+	keys := make([]string, 0, len(e.Errors))
+	for k := range e.Errors {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	msgs := make([]string, len(keys))
+	for i, k := range keys {
+		msgs[i] = k + ": " + e.Errors[k].Error()
+	}
+	return fmt.Sprintf("svalkey: batch failed for %d keys; %s",
+		len(keys), strings.Join(msgs, "; "))
+}
+
+func (o *BatchOptions) withDefaults() *BatchOptions {
+	opts := BatchOptions{}
+	if o != nil {
+		opts = *o
+	}
+	if opts.Concurrency < 1 {
+		opts.Concurrency = DefaultBatchConcurrency
+	}
+	if opts.Workers < 1 {
+		opts.Workers = runtime.NumCPU()
+	}
+	return &opts
+}
+
+// parallel calls f for every index in [0, n)
+// from at most workers goroutines
+func parallel(n, workers int, f func(i int)) {
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			f(i)
+		}
+		return
+	}
+	next := int64(-1)
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= n {
+					return
+				}
+				f(i)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// batchErrors collects non-nil errors of keys into BatchError
+func batchErrors(keys []string, errs []error) error {
+	var be *BatchError
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if be == nil {
+			be = &BatchError{Errors: map[string]error{}}
+		}
+		be.Errors[keys[i]] = err
+	}
+	if be == nil {
+		return nil
+	}
+	return be
+}
+
+// GetMany gets values of keys into out, which must be a pointer
+// to slice. Values are stored at the same index as their keys.
+// Values are fetched and decoded concurrently. If some keys fail
+// the returned error is *BatchError, their values are left zero
+func (s *Store) GetMany(keys []string, out interface{}, opts *BatchOptions) error {
+	return s.run(&Operation{Name: OpGetMany, Keys: keys, Value: out,
+		BatchOptions: opts}, s.handleGetMany)
+}
+
+func (s *Store) handleGetMany(op *Operation) error {
+	keys, opts := op.Keys, op.BatchOptions
+	v := reflect.ValueOf(op.Value)
+	if v.Kind() != reflect.Ptr {
+		return ErrorInvalidOutPointer
+	}
+	slice := v.Elem()
+	if slice.Kind() != reflect.Slice {
+		return ErrorInvalidOutSlice
+	}
+	opts = opts.withDefaults()
+	slice.Set(reflect.MakeSlice(slice.Type(), len(keys), len(keys)))
+	data := make([][]byte, len(keys))
+	errs := make([]error, len(keys))
+
+	if bs, ok := s.Store.(BatchStore); ok {
+		var pairs []*store.KVPair
+		err := s.backend("get_many", true, func() (err error) {
+			pairs, err = bs.GetMany(keys, opts.ReadOptions)
+			return err
+		})
+		values := map[string][]byte{}
+		for _, p := range pairs {
+			values[p.Key] = p.Value
+		}
+		for i, key := range keys {
+			switch val, ok := values[key]; {
+			case err != nil:
+				errs[i] = err
+			case !ok:
+				errs[i] = store.ErrKeyNotFound
+			case isManifest(val):
+				data[i], errs[i] = s.readChunks(key, val, opts.ReadOptions)
+			default:
+				data[i] = val
+			}
+		}
+	} else {
+		parallel(len(keys), opts.Concurrency, func(i int) {
+			data[i], errs[i] = s.get(keys[i], opts.ReadOptions)
+		})
+	}
+
+	upgraded := make([]bool, len(keys))
+	parallel(len(keys), opts.Workers, func(i int) {
+		if errs[i] != nil {
+			return
+		}
+		upgraded[i], errs[i] = s.decode(data[i],
+			slice.Index(i).Addr().Interface(), s.cipherSuites, s.key[:])
+		if errs[i] != nil {
+			slice.Index(i).Set(reflect.Zero(slice.Type().Elem()))
+		}
+	})
+	if s.migrateWriteBack {
+		for i, key := range keys {
+			if upgraded[i] {
+				errs[i] = s.writeBack(op.Context, key, slice.Index(i).Addr().Interface())
+			}
+		}
+	}
+	return batchErrors(keys, errs)
+}
+
+// PutMany puts values at their keys. Values are encoded
+// concurrently, if some of them fail nothing is written.
+// Writes are done in one call if the backend implements BatchStore
+// and values are not chunked, otherwise concurrently per key.
+// If some keys fail the returned error is *BatchError
+func (s *Store) PutMany(values map[string]interface{}, opts *BatchOptions) error {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return s.run(&Operation{Name: OpPutMany, Keys: keys, Value: values,
+		BatchOptions: opts}, s.handlePutMany)
+}
+
+func (s *Store) handlePutMany(op *Operation) error {
+	keys := op.Keys
+	values, ok := op.Value.(map[string]interface{})
+	if !ok {
+		return ErrorNilValue
+	}
+	opts := op.BatchOptions.withDefaults()
+	data := make([][]byte, len(keys))
+	errs := make([]error, len(keys))
+	parallel(len(keys), opts.Workers, func(i int) {
+		data[i], errs[i] = s.encode(values[keys[i]], s.cipherSuites, s.key[:])
+	})
+	if err := batchErrors(keys, errs); err != nil {
+		return err
+	}
+
+	if bs, ok := s.Store.(BatchStore); ok && !s.chunking() {
+		old, err := s.storedManifests(bs, keys)
+		if err != nil {
+			return err
+		}
+		pairs := make([]*store.KVPair, len(keys))
+		for i, key := range keys {
+			pairs[i] = &store.KVPair{Key: key, Value: data[i]}
+		}
+		defer s.changes.changed(keys...)
+		err = s.backend("put_many", false, func() error {
+			return bs.PutMany(pairs, opts.WriteOptions)
+		})
+		s.batchResult(keys, errs, old, err)
+		return batchErrors(keys, errs)
+	}
+	parallel(len(keys), opts.Concurrency, func(i int) {
+		errs[i] = s.put(keys[i], data[i], opts.WriteOptions)
+	})
+	return batchErrors(keys, errs)
+}
+
+// storedManifests returns manifests of chunked values stored
+// at keys before they are overwritten or deleted in one call.
+// It is empty if chunking was never enabled, see SetChunkSize
+func (s *Store) storedManifests(bs BatchStore, keys []string) (map[string]*manifest, error) {
+	old := map[string]*manifest{}
+	if !s.chunked {
+		return old, nil
+	}
+	var pairs []*store.KVPair
+	err := s.backend("get_manifest", true, func() (err error) {
+		pairs, err = bs.GetMany(keys, nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range pairs {
+		if m := s.parseStoredManifest(p.Key, p.Value); m != nil {
+			old[p.Key] = m
+		}
+	}
+	return old, nil
+}
+
+// batchResult sets errs of keys to err of batch call, or deletes
+// chunks of values replaced by successful batch call
+func (s *Store) batchResult(keys []string, errs []error,
+	old map[string]*manifest, err error) {
+	for i, key := range keys {
+		if err == nil {
+			errs[i] = s.deleteChunks(key, old[key], nil)
+		} else {
+			errs[i] = err
+		}
+	}
+}
+
+// DeleteMany deletes values at keys. Deletes are done in one call
+// if the backend implements BatchStore and values are not chunked,
+// otherwise concurrently per key. If some keys fail the returned
+// error is *BatchError
+func (s *Store) DeleteMany(keys []string, opts *BatchOptions) error {
+	return s.run(&Operation{Name: OpDeleteMany, Keys: keys,
+		BatchOptions: opts}, s.handleDeleteMany)
+}
+
+func (s *Store) handleDeleteMany(op *Operation) error {
+	keys := op.Keys
+	opts := op.BatchOptions.withDefaults()
+	errs := make([]error, len(keys))
+	if bs, ok := s.Store.(BatchStore); ok && !s.chunking() {
+		old, err := s.storedManifests(bs, keys)
+		if err != nil {
+			return err
+		}
+		defer s.changes.changed(keys...)
+		err = s.backend("delete_many", true, func() error {
+			return bs.DeleteMany(keys)
+		})
+		s.batchResult(keys, errs, old, err)
+		return batchErrors(keys, errs)
+	}
+	parallel(len(keys), opts.Concurrency, func(i int) {
+		errs[i] = s.delete(keys[i])
+	})
+	return batchErrors(keys, errs)
+}
@@ -0,0 +1,115 @@
+package svalkey
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/abronan/valkeyrie/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// batchMock implements BatchStore and counts batch calls
+type batchMock struct {
+	rewriteMock
+	calls *int
+}
+
+func (m batchMock) GetMany(keys []string,
+	options *store.ReadOptions) ([]*store.KVPair, error) {
+	*m.calls++
+	pairs := []*store.KVPair{}
+	for _, k := range keys {
+		if p, err := m.Mock.Get(k, options); err == nil {
+			pairs = append(pairs, p)
+		}
+	}
+	return pairs, nil
+}
+
+func (m batchMock) PutMany(pairs []*store.KVPair,
+	options *store.WriteOptions) error {
+	*m.calls++
+	for _, p := range pairs {
+		m.rewriteMock.Put(p.Key, p.Value, options)
+	}
+	return nil
+}
+
+func (m batchMock) DeleteMany(keys []string) error {
+	*m.calls++
+	for _, k := range keys {
+		if err := m.Mock.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func testBatch(t *testing.T, st *Store) {
+	values := map[string]interface{}{}
+	keys := []string{}
+	for i := 0; i < 50; i++ {
+		k := fmt.Sprintf("k%02d", i)
+		keys = append(keys, k)
+		values[k] = TestType{C: k}
+	}
+	err := st.PutMany(values, &BatchOptions{Workers: 4})
+	assert.Nil(t, err, "Err in PutMany must be nil")
+
+	out := []TestType{}
+	err = st.GetMany(append(keys, "missing"), &out, nil)
+	be, ok := err.(*BatchError)
+	assert.True(t, ok, "Err in GetMany must be *BatchError")
+	assert.Len(t, be.Errors, 1)
+	assert.Contains(t, be.Errors, "missing")
+	assert.Len(t, out, 51)
+	for i, k := range keys {
+		assert.Equal(t, k, out[i].C)
+	}
+	assert.Equal(t, TestType{}, out[50], "Missing value must be zero")
+
+	err = st.DeleteMany(keys[:10], nil)
+	assert.Nil(t, err, "Err in DeleteMany must be nil")
+	err = st.GetMany(keys, &out, nil)
+	assert.Len(t, err.(*BatchError).Errors, 10)
+}
+
+func TestStore_Batch(t *testing.T) {
+	st, err := NewCustomStore(rewriteMock{NewMock()}, JSONCodec{}, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	testBatch(t, st)
+
+	calls := 0
+	st, err = NewCustomStore(batchMock{rewriteMock{NewMock()}, &calls},
+		JSONCodec{}, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	testBatch(t, st)
+	assert.Equal(t, 4, calls, "Batch operations must use BatchStore")
+
+	// Values failing to encode prevent the whole batch
+	err = st.PutMany(map[string]interface{}{"ok": "ok", "bad": make(chan int)}, nil)
+	assert.Contains(t, err.(*BatchError).Errors, "bad")
+	ok, _ := st.Exists("ok", nil)
+	assert.False(t, ok, "No value must be written")
+}
+
+func TestStore_BatchChunks(t *testing.T) {
+	calls := 0
+	m := NewMock()
+	st, err := NewCustomStore(batchMock{rewriteMock{m}, &calls},
+		JSONCodec{}, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	st.SetChunkSize(64)
+	big := bytes.Repeat([]byte("chunked "), 50)
+	assert.Nil(t, st.Put("a", big, nil), "Err in Put must be nil")
+	assert.Nil(t, st.Put("b", big, nil), "Err in Put must be nil")
+
+	st.SetChunkSize(0)
+	calls = 0
+	assert.Nil(t, st.PutMany(map[string]interface{}{"a": big}, nil), "Err in PutMany must be nil")
+	assert.Equal(t, 2, calls, "Values which are not chunked must be put with BatchStore")
+	assert.False(t, isManifest(m.kv["a"]), "Value must not be chunked")
+	assert.Nil(t, st.DeleteMany([]string{"b"}, nil), "Err in DeleteMany must be nil")
+	assert.Empty(t, chunkKeys(m), "Batch operations must delete chunks of replaced values")
+}
@@ -0,0 +1,441 @@
+package svalkey
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abronan/valkeyrie/store"
+)
+
+// DefaultCacheSize is the number of values kept by
+// CachedStore if CacheOptions.Size is not set
+const DefaultCacheSize = 1024
+
+var (
+	// ErrMemLock represents unsupported memory locking error
+	ErrMemLock = fmt.Errorf("svalkey: in NewCachedStore" +
+		" memory locking is not supported on this platform")
+)
+
+// CacheOptions holds CachedStore settings
+type CacheOptions struct {
+	// Size is the maximum number of cached values
+	Size int
+	// TTL is the maximum age of cached value, zero means no limit
+	TTL time.Duration
+	// Watch is the backend directory watched for changes.
+	// Values changed under it by other clients are dropped
+	// from the cache. Empty Watch disables watching, then values
+	// are invalidated only by TTL and writes through CachedStore
+	Watch string
+	// Lock keeps cached plaintext in memory locked with mlock.
+	// Every value is locked in its own pages, so a full cache
+	// locks at least Size pages, 4 MiB for the default Size with
+	// 4 KiB pages. Values which can't be locked, for instance
+	// when RLIMIT_MEMLOCK is exceeded, are not cached, so Size
+	// must fit the limit
+	Lock bool
+}
+
+// CachedStore is a Store which keeps decrypted values in
+// a bounded LRU cache. Get and GetBytes are served from the cache,
+// so backend access, key derivation and decryption are skipped.
+// Values written or deleted through the Store or its copies made
+// by Scoped, WithContext and WithIdentity are dropped from the cache.
+// Cached plaintext is zeroed on eviction
+type CachedStore struct {
+	*Store
+	opts CacheOptions
+	// unsubscribe stops invalidation by Store writes
+	unsubscribe func()
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	// disabled is set when the watch stopped,
+	// then the cache is bypassed
+	disabled bool
+	// gen is incremented on every invalidation, values loaded
+	// before it are not cached
+	gen    uint64
+	stopCh chan struct{}
+	now    func() time.Time
+}
+
+// cacheEntry holds decrypted value. mu guards plain
+// from being zeroed while the value is decoded
+type cacheEntry struct {
+	mu      sync.RWMutex
+	key     string
+	plain   []byte
+	header  *header
+	digest  [sha256.Size]byte
+	expires time.Time
+	locked  bool
+	cached  bool
+}
+
+// NewCachedStore wraps s with read-through cache
+func NewCachedStore(s *Store, opts *CacheOptions) (*CachedStore, error) {
+	if s == nil {
+		return nil, ErrorNilStore
+	}
+	c := &CachedStore{
+		Store:   s,
+		lru:     list.New(),
+		entries: map[string]*list.Element{},
+		stopCh:  make(chan struct{}),
+		now:     time.Now,
+	}
+	if opts != nil {
+		c.opts = *opts
+	}
+	if c.opts.Size <= 0 {
+		c.opts.Size = DefaultCacheSize
+	}
+	if c.opts.Lock {
+		b, err := allocLocked(1)
+		if err != nil {
+			return nil, ErrMemLock
+		}
+		freeLocked(b)
+	}
+	if s.changes == nil {
+		s.changes = &changeFeed{}
+	}
+	c.unsubscribe = s.changes.subscribe(func(keys []string) {
+		if len(keys) == 1 && keys[0] == "" {
+			c.Purge()
+			return
+		}
+		for _, key := range keys {
+			c.Invalidate(key)
+		}
+	})
+	if c.opts.Watch != "" {
+		var events <-chan []*store.KVPair
+		err := s.run(&Operation{Name: OpWatch, Key: c.opts.Watch}, func(op *Operation) (err error) {
+			events, err = s.Store.WatchTree(op.Key, c.stopCh, nil)
+			return err
+		})
+		if err != nil {
+			c.unsubscribe()
+			return nil, err
+		}
+		go c.watch(events)
+	}
+	return c, nil
+}
+
+// watch drops cached values changed or deleted under watched
+// directory. If the watch fails the cache is disabled
+func (c *CachedStore) watch(events <-chan []*store.KVPair) {
+	for {
+		select {
+		case <-c.stopCh:
+			return
+		case pairs, ok := <-events:
+			if !ok {
+				c.mu.Lock()
+				c.disabled = true
+				c.purge()
+				c.mu.Unlock()
+				return
+			}
+			c.invalidate(pairs)
+		}
+	}
+}
+
+func (c *CachedStore) invalidate(pairs []*store.KVPair) {
+	current := make(map[string][sha256.Size]byte, len(pairs))
+	for _, p := range pairs {
+		current[strings.TrimLeft(p.Key, "/")] = sha256.Sum256(p.Value)
+	}
+	dir := strings.TrimLeft(c.opts.Watch, "/")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for key, el := range c.entries {
+		key = strings.TrimLeft(key, "/")
+		if !strings.HasPrefix(key, dir) {
+			continue
+		}
+		if digest, ok := current[key]; !ok || digest != el.Value.(*cacheEntry).digest {
+			c.remove(el)
+		}
+	}
+}
+
+// lookup returns cached entry with read lock held
+func (c *CachedStore) lookup(key string) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	e := el.Value.(*cacheEntry)
+	if c.opts.TTL > 0 && c.now().After(e.expires) {
+		c.remove(el)
+		return nil
+	}
+	c.lru.MoveToFront(el)
+	e.mu.RLock()
+	return e
+}
+
+// load reads and decrypts value at key. It returns entry with
+// read lock held, the entry is cached if possible
+func (c *CachedStore) load(key string, options *store.ReadOptions) (*cacheEntry, error) {
+	c.mu.Lock()
+	gen := c.gen
+	c.mu.Unlock()
+	var pair *store.KVPair
+	err := c.Store.backend("get", true, func() (err error) {
+		pair, err = c.Store.Store.Get(key, options)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	e := &cacheEntry{key: key, digest: sha256.Sum256(pair.Value)}
+	data := pair.Value
+	if isManifest(data) {
+		if data, err = c.Store.readChunks(key, data, options); err != nil {
+			return nil, err
+		}
+	}
+	c.Store.metrics.ObserveValueSize("read", len(data))
+	decrypted, h, err := c.Store.decryptReader(bytes.NewReader(data), c.Store.key[:])
+	if err != nil {
+		return nil, err
+	}
+	buf := pool.Get().(*bytes.Buffer)
+	defer func() {
+		zeroBytes(buf.Bytes())
+		buf.Reset()
+		pool.Put(buf)
+	}()
+	if _, err := io.Copy(buf, decrypted); err != nil {
+		return nil, c.Store.decodeError("error decode value", err)
+	}
+	e.header = h
+	if c.opts.Lock {
+		if e.plain, err = allocLocked(buf.Len()); err == nil {
+			e.locked = true
+		}
+	} else {
+		e.plain = make([]byte, buf.Len())
+	}
+	if e.plain == nil {
+		// value can't be locked, use it once
+		e.plain = append([]byte{}, buf.Bytes()...)
+		e.mu.RLock()
+		return e, nil
+	}
+	copy(e.plain, buf.Bytes())
+	e.expires = c.now().Add(c.opts.TTL)
+	e.mu.RLock()
+	c.add(e, gen)
+	return e, nil
+}
+
+// add caches e unless the cache was invalidated after gen
+func (c *CachedStore) add(e *cacheEntry, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.disabled || c.gen != gen {
+		return
+	}
+	e.cached = true
+	if el, ok := c.entries[e.key]; ok {
+		c.remove(el)
+	}
+	c.entries[e.key] = c.lru.PushFront(e)
+	for c.lru.Len() > c.opts.Size {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove evicts entry and zeroes its plaintext. c.mu must be held
+func (c *CachedStore) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, e.key)
+	e.free()
+}
+
+// release unlocks entry after read, plaintext
+// of entries which were not cached is zeroed
+func (e *cacheEntry) release() {
+	e.mu.RUnlock()
+	if !e.cached {
+		e.free()
+	}
+}
+
+// free zeroes plaintext when no one reads it
+func (e *cacheEntry) free() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.locked {
+		freeLocked(e.plain)
+	} else {
+		zeroBytes(e.plain)
+	}
+	e.plain = nil
+}
+
+func (c *CachedStore) purge() {
+	c.gen++
+	for c.lru.Len() > 0 {
+		c.remove(c.lru.Back())
+	}
+}
+
+// Invalidate drops value at key from the cache
+func (c *CachedStore) Invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+}
+
+// Purge drops all cached values
+func (c *CachedStore) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.purge()
+}
+
+func (c *CachedStore) entry(key string,
+	options *store.ReadOptions) (*cacheEntry, error) {
+	c.mu.Lock()
+	disabled := c.disabled
+	c.mu.Unlock()
+	if disabled {
+		return nil, nil
+	}
+	if e := c.lookup(key); e != nil {
+		c.Store.metrics.ObserveCache(true)
+		return e, nil
+	}
+	c.Store.metrics.ObserveCache(false)
+	return c.load(key, options)
+}
+
+// Get a value given its key, from the cache if possible
+func (c *CachedStore) Get(key string, value interface{},
+	options *store.ReadOptions) error {
+	return c.Store.run(&Operation{Name: OpGet, Key: key, Value: value,
+		ReadOptions: options}, c.handleGet)
+}
+
+func (c *CachedStore) handleGet(op *Operation) error {
+	if err := checkValue(op.Value); err != nil {
+		return err
+	}
+	e, err := c.entry(op.Key, op.ReadOptions)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return c.Store.handleGet(op)
+	}
+	upgraded, err := c.Store.decodePlain(bytes.NewReader(e.plain), e.header, op.Value)
+	e.release()
+	if err != nil {
+		return err
+	}
+	if upgraded && c.Store.migrateWriteBack {
+		c.Invalidate(op.Key)
+		return c.Store.writeBack(op.Context, op.Key, op.Value)
+	}
+	return nil
+}
+
+// GetBytes gets a value put with PutBytes or PutStream,
+// from the cache if possible
+func (c *CachedStore) GetBytes(key string,
+	options *store.ReadOptions) ([]byte, error) {
+	op := &Operation{Name: OpGetBytes, Key: key, ReadOptions: options}
+	if err := c.Store.run(op, c.handleGetBytes); err != nil {
+		return nil, err
+	}
+	value, _ := op.Result.([]byte)
+	return value, nil
+}
+
+func (c *CachedStore) handleGetBytes(op *Operation) error {
+	e, err := c.entry(op.Key, op.ReadOptions)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return c.Store.handleGetBytes(op)
+	}
+	defer e.release()
+	op.Result = append([]byte{}, e.plain...)
+	return nil
+}
+
+// Close stops watching, zeroes cached values
+// and closes the underlying Store
+func (c *CachedStore) Close() {
+	c.mu.Lock()
+	select {
+	case <-c.stopCh:
+	default:
+		close(c.stopCh)
+	}
+	c.disabled = true
+	c.purge()
+	c.mu.Unlock()
+	c.unsubscribe()
+	c.Store.Close()
+}
+
+// changeFeed notifies subscribed caches of keys written or
+// deleted through Store. Single empty key means any key
+// may have changed
+type changeFeed struct {
+	mu   sync.RWMutex
+	next int
+	subs map[int]func(keys []string)
+}
+
+// subscribe calls fn on every change until returned func is called
+func (f *changeFeed) subscribe(fn func(keys []string)) func() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.subs == nil {
+		f.subs = map[int]func(keys []string){}
+	}
+	id := f.next
+	f.next++
+	f.subs[id] = fn
+	return func() {
+		f.mu.Lock()
+		delete(f.subs, id)
+		f.mu.Unlock()
+	}
+}
+
+func (f *changeFeed) changed(keys ...string) {
+	if f == nil {
+		return
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for _, fn := range f.subs {
+		fn(keys)
+	}
+}
@@ -0,0 +1,165 @@
+package svalkey
+
+import (
+	"bytes"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/abronan/valkeyrie/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// watchMock counts backend reads and sends WatchTree events
+// from its events channel
+type watchMock struct {
+	rewriteMock
+	gets   *int32
+	events chan []*store.KVPair
+}
+
+func (m watchMock) Get(key string,
+	options *store.ReadOptions) (*store.KVPair, error) {
+	atomic.AddInt32(m.gets, 1)
+	return m.rewriteMock.Get(key, options)
+}
+
+func (m watchMock) WatchTree(directory string,
+	stopCh <-chan struct{}, options *store.ReadOptions) (<-chan []*store.KVPair, error) {
+	return m.events, nil
+}
+
+// event sends current state of the backend as watch event
+func (m watchMock) event() {
+	pairs, _ := m.Mock.List("", nil)
+	m.events <- pairs
+}
+
+func newCachedStore(t *testing.T, opts *CacheOptions) (*CachedStore, watchMock) {
+	m := watchMock{rewriteMock{NewMock()}, new(int32), make(chan []*store.KVPair)}
+	st, err := NewCustomStore(m, JSONCodec{}, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	c, err := NewCachedStore(st, opts)
+	assert.Nil(t, err, "Err in NewCachedStore must be nil")
+	return c, m
+}
+
+func TestCachedStore_Get(t *testing.T) {
+	c, m := newCachedStore(t, &CacheOptions{Watch: "app"})
+	defer c.Close()
+	assert.Nil(t, c.Put("app/a", TestType{C: "a"}, nil), "Err in Put must be nil")
+	atomic.StoreInt32(m.gets, 0)
+
+	for i := 0; i < 3; i++ {
+		out := TestType{}
+		assert.Nil(t, c.Get("app/a", &out, nil), "Err in Get must be nil")
+		assert.Equal(t, "a", out.C)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(m.gets), "Value must be read from backend once")
+
+	assert.Nil(t, c.Put("app/a", TestType{C: "b"}, nil), "Err in Put must be nil")
+	out := TestType{}
+	assert.Nil(t, c.Get("app/a", &out, nil), "Err in Get must be nil")
+	assert.Equal(t, "b", out.C, "Put must invalidate cached value")
+
+	// Write by other client is noticed by watch
+	assert.Nil(t, c.Store.Put("app/a", TestType{C: "c"}, nil), "Err in Put must be nil")
+	m.event()
+	m.event()
+	assert.Nil(t, c.Get("app/a", &out, nil), "Err in Get must be nil")
+	assert.Equal(t, "c", out.C, "Watch must invalidate cached value")
+
+	assert.Nil(t, c.Delete("app/a"), "Err in Delete must be nil")
+	assert.NotNil(t, c.Get("app/a", &out, nil), "Err in Get of deleted key must not be nil")
+
+	assert.Nil(t, c.PutBytes("app/raw", []byte("raw"), nil), "Err in PutBytes must be nil")
+	for i := 0; i < 2; i++ {
+		b, err := c.GetBytes("app/raw", nil)
+		assert.Nil(t, err, "Err in GetBytes must be nil")
+		assert.Equal(t, []byte("raw"), b)
+	}
+
+	// Closed watch disables the cache
+	close(m.events)
+	time.Sleep(10 * time.Millisecond)
+	gets := atomic.LoadInt32(m.gets)
+	_, err := c.GetBytes("app/raw", nil)
+	assert.Nil(t, err, "Err in GetBytes must be nil")
+	_, err = c.GetBytes("app/raw", nil)
+	assert.Nil(t, err, "Err in GetBytes must be nil")
+	assert.Equal(t, gets+2, atomic.LoadInt32(m.gets), "Disabled cache must read backend")
+}
+
+func TestCachedStore_InvalidateStoreWrites(t *testing.T) {
+	c, _ := newCachedStore(t, nil)
+	defer c.Close()
+	get := func() (string, error) {
+		out := TestType{}
+		err := c.Get("app/a", &out, nil)
+		return out.C, err
+	}
+	assert.Nil(t, c.Put("app/a", TestType{C: "a"}, nil), "Err in Put must be nil")
+	archive := &bytes.Buffer{}
+	assert.Nil(t, c.Export("app", archive, nil), "Err in Export must be nil")
+	v, _ := get()
+	assert.Equal(t, "a", v, "Get must return put value")
+
+	assert.Nil(t, c.WithIdentity("ops").Put("app/a", TestType{C: "b"}, nil),
+		"Err in Put must be nil")
+	v, _ = get()
+	assert.Equal(t, "b", v, "Put through Store copy must drop cached value")
+
+	_, err := c.Import(archive, &ImportOptions{Conflict: ConflictOverwrite})
+	assert.Nil(t, err, "Err in Import must be nil")
+	v, _ = get()
+	assert.Equal(t, "a", v, "Import must drop cached value")
+
+	scoped, err := c.Scoped("app")
+	assert.Nil(t, err, "Err in Scoped must be nil")
+	assert.Nil(t, scoped.DeleteTree("app/"), "Err in DeleteTree must be nil")
+	_, err = get()
+	assert.NotNil(t, err, "DeleteTree through scoped Store must drop cached values")
+}
+
+func TestCachedStore_Eviction(t *testing.T) {
+	c, m := newCachedStore(t, &CacheOptions{Size: 2, TTL: time.Minute})
+	defer c.Close()
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	for _, k := range []string{"a", "b", "c"} {
+		assert.Nil(t, c.PutBytes(k, []byte(k), nil), "Err in PutBytes must be nil")
+		_, err := c.GetBytes(k, nil)
+		assert.Nil(t, err, "Err in GetBytes must be nil")
+	}
+	assert.Len(t, c.entries, 2, "Cache must be bounded")
+	assert.NotContains(t, c.entries, "a", "Least recently used value must be evicted")
+
+	e := c.entries["b"].Value.(*cacheEntry)
+	now = now.Add(2 * time.Minute)
+	gets := atomic.LoadInt32(m.gets)
+	_, err := c.GetBytes("b", nil)
+	assert.Nil(t, err, "Err in GetBytes must be nil")
+	assert.Equal(t, gets+1, atomic.LoadInt32(m.gets), "Expired value must be read from backend")
+	assert.Nil(t, e.plain, "Evicted plaintext must be released")
+}
+
+func TestCachedStore_Lock(t *testing.T) {
+	st, err := NewCustomStore(NewMock(), JSONCodec{}, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	c, err := NewCachedStore(st, &CacheOptions{Lock: true})
+	if err == ErrMemLock {
+		t.Skip("memory locking is not supported")
+	}
+	assert.Nil(t, err, "Err in NewCachedStore must be nil")
+	defer c.Close()
+	assert.Nil(t, c.Put("k", TestType{C: "locked"}, nil), "Err in Put must be nil")
+	out := TestType{}
+	assert.Nil(t, c.Get("k", &out, nil), "Err in Get must be nil")
+	assert.Equal(t, "locked", out.C)
+	el, ok := c.entries["k"]
+	assert.True(t, ok, "Value must be cached")
+	e := el.Value.(*cacheEntry)
+	assert.True(t, e.locked, "Cached value must be locked")
+	c.Purge()
+	assert.Nil(t, e.plain, "Purged plaintext must be released")
+}
@@ -0,0 +1,412 @@
+package svalkey
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/abronan/valkeyrie/store"
+)
+
+// chunksDir is the directory under a value key where
+// chunks of a large value are stored
+const chunksDir = "/_chunks/"
+
+// manifestMagic prefixes chunk manifest values. Regular values
+// start with the envelope magic or, in legacy format, with
+// a random 32 byte nonce, so a collision is negligible
+var manifestMagic = []byte("SVKCHNK2")
+
+const (
+	manifestHeaderSize = 8 + 4 + 8 + genSize
+	genSize            = 8
+)
+
+var (
+	// ErrChunkMissing represents missing chunk of a chunked value error
+	ErrChunkMissing = fmt.Errorf("svalkey: in Get" +
+		" chunk of value is missing")
+	// ErrChunkCorrupted represents chunk integrity error: the chunk
+	// was modified, reordered or belongs to other value
+	ErrChunkCorrupted = fmt.Errorf("svalkey: in Get" +
+		" chunk of value failed integrity check")
+	// ErrManifestCorrupted represents chunk manifest integrity error
+	ErrManifestCorrupted = fmt.Errorf("svalkey: in Get" +
+		" chunk manifest failed integrity check")
+)
+
+// chunking reports if values are split into chunks.
+// Manifest HMAC key is derived from the Store key, so sealed
+// values and values with recipients are never chunked
+func (s *Store) chunking() bool {
+	return s.chunkSize > 0 && s.recipient == nil && len(s.recipients) == 0
+}
+
+// manifest describes a value which is split across
+// key/_chunks/<generation>/N entries. Every write of the value
+// puts its chunks under new random generation before the manifest,
+// so failed write leaves the previous value readable.
+//
+// The manifest value layout is:
+//
+//	magic | chunks count | total size | generation | chunk hashes | HMAC
+//	  8          4             8            8         32 * count     32
+//
+// HMAC authenticates the value key, so chunks and manifest
+// can't be moved to other key
+type manifest struct {
+	size   uint64
+	gen    string
+	hashes [][]byte
+}
+
+// SetChunkSize enables chunking mode. Encrypted values larger
+// than size bytes are split across key/_chunks/<generation>/N
+// entries. Zero size disables chunking for Put, chunked values
+// are still readable and their chunks are still cleaned up
+// by Put and Delete. Stores with a private key or recipients
+// put values whole, the manifest is authenticated with
+// the Store key, which other readers don't have.
+//
+// Put and Delete read the replaced value to find its chunks only
+// if chunking was enabled on the Store. Chunks of values replaced
+// by Store which never enabled it are left orphaned, Verify
+// reports them
+func (s *Store) SetChunkSize(size int) {
+	if size < 0 {
+		size = 0
+	}
+	s.chunkSize = size
+	if size > 0 {
+		s.chunked = true
+	}
+}
+
+// chunkKey returns key of chunk n of generation gen
+func chunkKey(key, gen string, n int) string {
+	return key + chunksDir + gen + "/" + strconv.Itoa(n)
+}
+
+func newGeneration() (string, error) {
+	var b [genSize]byte
+	if _, err := io.ReadFull(rand.Reader, b[:]); err != nil {
+		return "", fmt.Errorf("svalkey: error chunk generation; %s", err.Error())
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// isChunkKey reports if key is a chunk key. Put rejects
+// keys with _chunks segment, so user keys never match
+func isChunkKey(key string) bool {
+	return strings.Contains(key, chunksDir)
+}
+
+func isManifest(data []byte) bool {
+	return len(data) >= manifestHeaderSize+sha256.Size &&
+		bytes.Equal(data[:len(manifestMagic)], manifestMagic)
+}
+
+func (s *Store) manifestMAC(key string, body []byte) []byte {
+	mkey := s.subKey("svalkey chunk manifest")
+	defer zeroBytes(mkey)
+	mac := hmac.New(sha256.New, mkey)
+	mac.Write([]byte(key))
+	mac.Write([]byte{0})
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+func (s *Store) marshalManifest(key string, m *manifest) []byte {
+	body := make([]byte, manifestHeaderSize, manifestHeaderSize+
+		len(m.hashes)*sha256.Size+sha256.Size)
+	copy(body, manifestMagic)
+	binary.BigEndian.PutUint32(body[8:], uint32(len(m.hashes)))
+	binary.BigEndian.PutUint64(body[12:], m.size)
+	hex.Decode(body[20:], []byte(m.gen))
+	for _, h := range m.hashes {
+		body = append(body, h...)
+	}
+	return append(body, s.manifestMAC(key, body)...)
+}
+
+func (s *Store) unmarshalManifest(key string, data []byte) (*manifest, error) {
+	if !isManifest(data) {
+		return nil, ErrManifestCorrupted
+	}
+	count := int(binary.BigEndian.Uint32(data[8:]))
+	bodyLen := manifestHeaderSize + count*sha256.Size
+	if count <= 0 || len(data) != bodyLen+sha256.Size {
+		return nil, ErrManifestCorrupted
+	}
+	if !hmac.Equal(data[bodyLen:], s.manifestMAC(key, data[:bodyLen])) {
+		return nil, ErrManifestCorrupted
+	}
+	m := &manifest{
+		size:   binary.BigEndian.Uint64(data[12:]),
+		gen:    hex.EncodeToString(data[20:manifestHeaderSize]),
+		hashes: make([][]byte, count),
+	}
+	for i := range m.hashes {
+		off := manifestHeaderSize + i*sha256.Size
+		m.hashes[i] = data[off : off+sha256.Size]
+	}
+	return m, nil
+}
+
+// readChunks reassembles a chunked value given its manifest
+func (s *Store) readChunks(key string, data []byte,
+	options *store.ReadOptions) ([]byte, error) {
+	m, err := s.unmarshalManifest(key, data)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, m.size)
+	for i, h := range m.hashes {
+		var pair *store.KVPair
+		err := s.backend("get_chunk", true, func() (err error) {
+			pair, err = s.Store.Get(chunkKey(key, m.gen, i), options)
+			return err
+		})
+		if err != nil {
+			if err == store.ErrKeyNotFound {
+				return nil, ErrChunkMissing
+			}
+			return nil, err
+		}
+		sum := sha256.Sum256(pair.Value)
+		if !hmac.Equal(sum[:], h) {
+			return nil, ErrChunkCorrupted
+		}
+		out = append(out, pair.Value...)
+	}
+	if uint64(len(out)) != m.size {
+		return nil, ErrManifestCorrupted
+	}
+	return out, nil
+}
+
+// storedManifest returns manifest of the value stored at key
+// before it is overwritten or deleted, nil if the value
+// is not chunked or chunking was never enabled, see SetChunkSize
+func (s *Store) storedManifest(key string) (*manifest, error) {
+	if !s.chunked {
+		return nil, nil
+	}
+	var pair *store.KVPair
+	err := s.backend("get_manifest", true, func() (err error) {
+		pair, err = s.Store.Get(key, nil)
+		return err
+	})
+	if err == store.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.parseStoredManifest(key, pair.Value), nil
+}
+
+// parseStoredManifest returns manifest of stored value data,
+// nil if it is not chunked. Chunks of corrupted manifest
+// can't be found, so it is treated as not chunked
+func (s *Store) parseStoredManifest(key string, data []byte) *manifest {
+	if !isManifest(data) {
+		return nil
+	}
+	m, err := s.unmarshalManifest(key, data)
+	if err != nil {
+		return nil
+	}
+	return m
+}
+
+// deleteChunks deletes chunks of manifest old which are not
+// referenced by manifest cur of the value replacing it.
+// Nil cur means the value is deleted or not chunked
+func (s *Store) deleteChunks(key string, old, cur *manifest) error {
+	if old == nil {
+		return nil
+	}
+	from := 0
+	if cur != nil && cur.gen == old.gen {
+		from = len(cur.hashes)
+	}
+	for i := from; i < len(old.hashes); i++ {
+		err := s.backend("delete_chunk", true, func() error {
+			err := s.Store.Delete(chunkKey(key, old.gen, i))
+			if err == store.ErrKeyNotFound {
+				return nil
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chunkWriter splits written data into chunks of fixed size
+// and puts them into backend store under new generation.
+// Close writes the manifest and removes chunks of a previous
+// value. Failed write removes chunks written so far
+type chunkWriter struct {
+	s       *Store
+	key     string
+	options *store.WriteOptions
+	buf     []byte
+	m       manifest
+	old     *manifest
+}
+
+func (s *Store) newChunkWriter(key string,
+	options *store.WriteOptions) (*chunkWriter, error) {
+	gen, err := newGeneration()
+	if err != nil {
+		return nil, err
+	}
+	old, err := s.storedManifest(key)
+	if err != nil {
+		return nil, err
+	}
+	return &chunkWriter{
+		s:       s,
+		key:     key,
+		options: options,
+		buf:     make([]byte, 0, s.chunkSize),
+		m:       manifest{gen: gen},
+		old:     old,
+	}, nil
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		free := cap(w.buf) - len(w.buf)
+		if free > len(p) {
+			free = len(p)
+		}
+		w.buf = append(w.buf, p[:free]...)
+		p = p[free:]
+		if len(w.buf) == cap(w.buf) {
+			if err := w.flush(); err != nil {
+				w.abort()
+				return n - len(p), err
+			}
+		}
+	}
+	return n, nil
+}
+
+func (w *chunkWriter) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	sum := sha256.Sum256(w.buf)
+	chunk := append([]byte(nil), w.buf...)
+	err := w.s.backend("put_chunk", true, func() error {
+		return w.s.Store.Put(chunkKey(w.key, w.m.gen, len(w.m.hashes)), chunk, w.options)
+	})
+	if err != nil {
+		return err
+	}
+	w.m.hashes = append(w.m.hashes, sum[:])
+	w.m.size += uint64(len(w.buf))
+	w.buf = w.buf[:0]
+	return nil
+}
+
+func (w *chunkWriter) Close() error {
+	if err := w.flush(); err != nil {
+		w.abort()
+		return err
+	}
+	data := w.s.marshalManifest(w.key, &w.m)
+	err := w.s.backend("put", false, func() error {
+		return w.s.Store.Put(w.key, data, w.options)
+	})
+	if err != nil {
+		w.abort()
+		return err
+	}
+	return w.s.deleteChunks(w.key, w.old, &w.m)
+}
+
+// abort removes chunks written by w. The previous value
+// and its chunks are left intact
+func (w *chunkWriter) abort() {
+	w.s.deleteChunks(w.key, &w.m, nil)
+}
+
+// putChunked splits value across key/_chunks/<generation>/N entries
+func (s *Store) putChunked(key string, value []byte,
+	options *store.WriteOptions) error {
+	w, err := s.newChunkWriter(key, options)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(value); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// chunkReader lazily fetches and verifies chunks
+// of a value given its manifest
+type chunkReader struct {
+	s       *Store
+	key     string
+	options *store.ReadOptions
+	m       *manifest
+	next    int
+	buf     []byte
+}
+
+func (s *Store) newChunkReader(key string, data []byte,
+	options *store.ReadOptions) (*chunkReader, error) {
+	m, err := s.unmarshalManifest(key, data)
+	if err != nil {
+		return nil, err
+	}
+	return &chunkReader{
+		s:       s,
+		key:     key,
+		options: options,
+		m:       m,
+	}, nil
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.next == len(r.m.hashes) {
+			return 0, io.EOF
+		}
+		var pair *store.KVPair
+		err := r.s.backend("get_chunk", true, func() (err error) {
+			pair, err = r.s.Store.Get(chunkKey(r.key, r.m.gen, r.next), r.options)
+			return err
+		})
+		if err != nil {
+			if err == store.ErrKeyNotFound {
+				return 0, ErrChunkMissing
+			}
+			return 0, err
+		}
+		sum := sha256.Sum256(pair.Value)
+		if !hmac.Equal(sum[:], r.m.hashes[r.next]) {
+			return 0, ErrChunkCorrupted
+		}
+		r.buf = pair.Value
+		r.next++
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
@@ -0,0 +1,181 @@
+package svalkey
+
+import (
+	"bytes"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"github.com/abronan/valkeyrie/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// rewriteMock allows to overwrite existing keys like real backends do
+type rewriteMock struct {
+	*Mock
+}
+
+func (m rewriteMock) Put(key string,
+	value []byte, options *store.WriteOptions) error {
+	m.Mock.Delete(key)
+	return m.Mock.Put(key, value, options)
+}
+
+func newChunkedStore(t *testing.T) (*Store, *Mock) {
+	m := NewMock()
+	st, err := NewCustomStore(rewriteMock{m}, JSONCodec{}, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	st.SetChunkSize(256)
+	return st, m
+}
+
+// storedChunkKey returns key of chunk n of the value stored at key
+func storedChunkKey(st *Store, key string, n int) string {
+	m, _ := st.storedManifest(key)
+	return chunkKey(key, m.gen, n)
+}
+
+func chunkKeys(m *Mock) []string {
+	keys := []string{}
+	for k := range m.kv {
+		if isChunkKey(k) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func TestStore_PutAndGetChunked(t *testing.T) {
+	st, m := newChunkedStore(t)
+
+	v := make([]byte, 1000)
+	rand.Read(v)
+	err := st.Put("big", v, nil)
+	assert.Nil(t, err, "Err in Put must be nil")
+	assert.True(t, isManifest(m.kv["big"]), "Value must be stored as manifest")
+	assert.True(t, len(chunkKeys(m)) > 1, "Value must be split into chunks")
+	for _, k := range chunkKeys(m) {
+		assert.True(t, strings.HasPrefix(k, "big/_chunks/"))
+		assert.True(t, len(m.kv[k]) <= 256, "Chunk must not exceed chunk size")
+	}
+
+	out := []byte{}
+	err = st.Get("big", &out, nil)
+	assert.Nil(t, err, "Err in Get must be nil")
+	assert.Equal(t, v, out, "Result Put->Get Value must be equal")
+
+	list := [][]byte{}
+	retList, err := st.List("", &list, nil)
+	assert.Nil(t, err, "Err in List must be nil")
+	assert.Len(t, retList, 1, "List must skip chunk entries")
+	assert.Equal(t, v, list[0], "List value must be reassembled")
+
+	// Overwrite with a small value removes stale chunks
+	err = st.Put("big", []byte("small"), nil)
+	assert.Nil(t, err, "Err in Put must be nil")
+	assert.Empty(t, chunkKeys(m), "Stale chunks must be deleted")
+
+	err = st.Put("big", v, nil)
+	assert.Nil(t, err, "Err in Put must be nil")
+	err = st.Delete("big")
+	assert.Nil(t, err, "Err in Delete must be nil")
+	assert.Empty(t, m.kv, "Delete must remove value and all chunks")
+}
+
+func TestStore_GetChunkedIntegrity(t *testing.T) {
+	st, m := newChunkedStore(t)
+
+	v := bytes.Repeat([]byte("chunked secret value "), 20)
+	assert.Nil(t, st.Put("a", v, nil), "Err in Put must be nil")
+	assert.Nil(t, st.Put("b", v[1:], nil), "Err in Put must be nil")
+	out := []byte{}
+
+	// Reordered chunks
+	c0, c1 := m.kv[storedChunkKey(st, "a", 0)], m.kv[storedChunkKey(st, "a", 1)]
+	m.kv[storedChunkKey(st, "a", 0)], m.kv[storedChunkKey(st, "a", 1)] = c1, c0
+	assert.Equal(t, ErrChunkCorrupted, st.Get("a", &out, nil))
+	m.kv[storedChunkKey(st, "a", 0)], m.kv[storedChunkKey(st, "a", 1)] = c0, c1
+	assert.Nil(t, st.Get("a", &out, nil), "Err in Get must be nil")
+
+	// Foreign chunk
+	m.kv[storedChunkKey(st, "a", 1)] = m.kv[storedChunkKey(st, "b", 1)]
+	assert.Equal(t, ErrChunkCorrupted, st.Get("a", &out, nil))
+	m.kv[storedChunkKey(st, "a", 1)] = c1
+
+	// Foreign manifest
+	m.kv["c"] = m.kv["a"]
+	assert.Equal(t, ErrManifestCorrupted, st.Get("c", &out, nil))
+	delete(m.kv, "c")
+
+	// Missing chunk
+	delete(m.kv, storedChunkKey(st, "a", 1))
+	assert.NotNil(t, st.Get("a", &out, nil), "Err in Get must not be nil")
+}
+
+// failingMock fails Put of keys for which fail returns true
+type failingMock struct {
+	rewriteMock
+	fail func(key string) bool
+}
+
+func (m failingMock) Put(key string,
+	value []byte, options *store.WriteOptions) error {
+	if m.fail(key) {
+		return store.ErrBackendNotSupported
+	}
+	return m.rewriteMock.Put(key, value, options)
+}
+
+func TestStore_PutChunkedFailure(t *testing.T) {
+	m := NewMock()
+	fail := false
+	st, err := NewCustomStore(failingMock{rewriteMock{m}, func(key string) bool {
+		return fail && strings.HasSuffix(key, "/2")
+	}}, JSONCodec{}, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	st.SetChunkSize(256)
+
+	v := bytes.Repeat([]byte("old chunked value "), 50)
+	assert.Nil(t, st.Put("a", v, nil), "Err in Put must be nil")
+	old := chunkKeys(m)
+	fail = true
+	err = st.Put("a", bytes.Repeat([]byte("new chunked value "), 50), nil)
+	assert.NotNil(t, err, "Err in failed Put must not be nil")
+	out := []byte{}
+	assert.Nil(t, st.Get("a", &out, nil), "Err in Get after failed Put must be nil")
+	assert.Equal(t, v, out, "Failed Put must keep the previous value")
+	assert.ElementsMatch(t, old, chunkKeys(m), "Failed Put must remove its chunks")
+
+	fail = false
+	st.SetChunkSize(0)
+	assert.Nil(t, st.Delete("a"), "Err in Delete must be nil")
+	assert.Empty(t, m.kv, "Delete must remove chunks with chunking disabled")
+}
+
+func TestStore_PutChunkKey(t *testing.T) {
+	st, m := newChunkedStore(t)
+	for _, key := range []string{"a/_chunks/b", "a/_chunks/0"} {
+		assert.Equal(t, ErrInvalidPath, st.Put(key, []byte("v"), nil),
+			"Put of key with _chunks segment must fail")
+		assert.Equal(t, ErrInvalidPath, st.PutStream(key, strings.NewReader("v"), nil),
+			"PutStream of key with _chunks segment must fail")
+	}
+	assert.Equal(t, ErrInvalidPath, st.PutMany(map[string]interface{}{
+		"a/_chunks/b": []byte("v")}, nil), "PutMany of key with _chunks segment must fail")
+	assert.Empty(t, m.kv, "Keys with _chunks segment must not be written")
+	assert.Nil(t, st.Put("a/_chunksb", []byte("v"), nil), "Err in Put must be nil")
+}
+
+func TestStore_PutManifestLookup(t *testing.T) {
+	m := &flakyMock{Mock: NewMock(), op: "get", fails: 1}
+	st, err := NewCustomStore(m, JSONCodec{}, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	assert.Nil(t, st.Put("a", []byte("v"), nil), "Err in Put must be nil")
+	assert.Nil(t, st.Delete("a"), "Err in Delete must be nil")
+	assert.Equal(t, 0, m.calls, "Store which never enabled chunking must not read replaced value")
+
+	st.SetChunkSize(256)
+	assert.Equal(t, store.ErrNotReachable, st.Put("a", []byte("v"), nil),
+		"Err of manifest lookup must be returned")
+	assert.NotContains(t, m.kv, "a", "Value must not be written if manifest lookup fails")
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/karantin2020/svalkey"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// entry is a key/value pair printed in json and yaml output
+type entry struct {
+	Key   string      `json:"key" yaml:"key"`
+	Value interface{} `json:"value,omitempty" yaml:"value,omitempty"`
+}
+
+func runPut(c *cli, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("usage: put KEY [VALUE]")
+	}
+	var (
+		data []byte
+		err  error
+	)
+	if len(args) == 2 {
+		data = []byte(args[1])
+	} else if data, err = ioutil.ReadAll(c.in); err != nil {
+		return fmt.Errorf("read value: %v", err)
+	}
+	switch c.opts.codec {
+	case "raw":
+		return c.store.PutBytes(args[0], data, nil)
+	case "json":
+		var v interface{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return fmt.Errorf("value is not valid JSON: %v", err)
+		}
+		return c.store.Put(args[0], v, nil)
+	}
+	return c.store.Put(args[0], string(data), nil)
+}
+
+func runGet(c *cli, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: get KEY")
+	}
+	var (
+		v   interface{}
+		err error
+	)
+	switch c.opts.codec {
+	case "raw":
+		var b []byte
+		b, err = c.store.GetBytes(args[0], nil)
+		v = string(b)
+	case "json":
+		err = c.store.Get(args[0], &v, nil)
+	default:
+		var s string
+		err = c.store.Get(args[0], &s, nil)
+		v = s
+	}
+	if err != nil {
+		return err
+	}
+	if c.opts.output == "text" {
+		return c.printText(v)
+	}
+	return c.print(entry{Key: args[0], Value: v})
+}
+
+func runList(c *cli, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: ls [PREFIX]")
+	}
+	prefix := ""
+	if len(args) == 1 {
+		prefix = args[0]
+	}
+	var out interface{}
+	switch c.opts.codec {
+	case "raw":
+		out = &[][]byte{}
+	case "json":
+		out = &[]interface{}{}
+	default:
+		out = &[]string{}
+	}
+	pairs, err := c.store.List(prefix, out, nil)
+	if err != nil {
+		return err
+	}
+	entries := make([]entry, 0, len(pairs))
+	for _, p := range pairs {
+		v := p.Value()
+		if b, ok := v.([]byte); ok {
+			v = string(b)
+		}
+		entries = append(entries, entry{Key: p.Key(), Value: v})
+	}
+	if c.opts.output == "text" {
+		for _, e := range entries {
+			fmt.Fprintln(c.out, e.Key)
+		}
+		return nil
+	}
+	return c.print(entries)
+}
+
+func runDelete(c *cli, args []string) error {
+	fs := flag.NewFlagSet("rm", flag.ContinueOnError)
+	recursive := fs.Bool("r", false, "delete all keys under KEY")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: rm [-r] KEY")
+	}
+	if *recursive {
+		return c.store.DeleteTree(fs.Arg(0))
+	}
+	return c.store.Delete(fs.Arg(0))
+}
+
+func runExists(c *cli, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: exists KEY")
+	}
+	ok, err := c.store.Exists(args[0], nil)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		c.status = 1
+	}
+	if c.opts.output == "text" {
+		fmt.Fprintln(c.out, ok)
+		return nil
+	}
+	return c.print(map[string]interface{}{"key": args[0], "exists": ok})
+}
+
+func (c *cli) printText(v interface{}) error {
+	switch val := v.(type) {
+	case string:
+		_, err := io.WriteString(c.out, val)
+		return err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.out, string(data))
+	return nil
+}
+
+func (c *cli) print(v interface{}) error {
+	var (
+		data []byte
+		err  error
+	)
+	if c.opts.output == "yaml" {
+		data, err = yaml.Marshal(v)
+	} else {
+		data, err = json.MarshalIndent(v, "", "  ")
+		data = append(data, '\n')
+	}
+	if err != nil {
+		return err
+	}
+	_, err = c.out.Write(data)
+	return err
+}
+
+func runMigrate(c *cli, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	var dstOpts storeOptions
+	dstOpts.register(fs, "to-", &c.opts.storeOptions)
+	reencrypt := fs.Bool("reencrypt", false, "decrypt values and encrypt them with destination key")
+	workers := fs.Int("workers", 4, "number of values copied concurrently")
+	checkpoint := fs.String("checkpoint", "", "file to record copied keys and resume from")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return fmt.Errorf("usage: migrate [-to-FLAG ...] [PREFIX]")
+	}
+	if dstOpts.codec != c.opts.codec {
+		return fmt.Errorf("migrate can't change codec of untyped values")
+	}
+	dst, err := openStore(&dstOpts)
+	if err != nil {
+		return fmt.Errorf("open destination: %v", err)
+	}
+	defer dst.Close()
+	mopts := &svalkey.MigrateOptions{
+		Reencrypt: *reencrypt,
+		Workers:   *workers,
+	}
+	if *checkpoint != "" {
+		cp, err := svalkey.NewFileCheckpoint(*checkpoint)
+		if err != nil {
+			return err
+		}
+		defer cp.Close()
+		mopts.Checkpoint = cp
+	}
+	rep, err := svalkey.Migrate(c.store, dst, fs.Arg(0), mopts)
+	if err != nil {
+		return err
+	}
+	if len(rep.Failed) > 0 || len(rep.Missing) > 0 {
+		c.status = 1
+	}
+	if c.opts.output == "text" {
+		fmt.Fprintf(c.out, "copied: %d, skipped: %d, failed: %d, missing: %d, extra: %d\n",
+			len(rep.Copied), len(rep.Skipped), len(rep.Failed),
+			len(rep.Missing), len(rep.Extra))
+		for key, err := range rep.Failed {
+			fmt.Fprintf(c.out, "failed %s: %s\n", key, err)
+		}
+		return nil
+	}
+	return c.print(rep)
+}
+
+func runVerify(c *cli, args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	decode := fs.Bool("decode", false, "also decode values with the codec")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return fmt.Errorf("usage: verify [-decode] [PREFIX]")
+	}
+	vopts := &svalkey.VerifyOptions{}
+	if *decode {
+		vopts.NewValue = func(string) interface{} {
+			switch c.opts.codec {
+			case "raw":
+				return &[]byte{}
+			case "json":
+				return new(interface{})
+			}
+			return new(string)
+		}
+	}
+	rep, err := c.store.Verify(fs.Arg(0), vopts)
+	if err != nil {
+		return err
+	}
+	if !rep.OK() {
+		c.status = 1
+	}
+	if c.opts.output == "text" {
+		for _, e := range rep.Entries {
+			if e.Error != "" {
+				fmt.Fprintf(c.out, "%s\t%s\t%s\n", e.Status, e.Key, e.Error)
+			} else {
+				fmt.Fprintf(c.out, "%s\t%s\n", e.Status, e.Key)
+			}
+		}
+		return nil
+	}
+	return c.print(rep)
+}
+
+func runSplit(c *cli, args []string) error {
+	fs := flag.NewFlagSet("split", flag.ContinueOnError)
+	n := fs.Int("n", 5, "number of shares")
+	k := fs.Int("k", 3, "number of shares which unseal the key")
+	dir := fs.String("out-dir", "", "directory to write shares to, one share-N file per share")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 || *dir == "" {
+		return fmt.Errorf("usage: split [-n N] [-k K] -out-dir DIR")
+	}
+	key, err := loadKey(&c.opts.storeOptions)
+	if err != nil {
+		return err
+	}
+	shares, err := svalkey.SplitKey(key, *n, *k)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*dir, 0700); err != nil {
+		return err
+	}
+	files := make([]string, len(shares))
+	for i, s := range shares {
+		files[i] = filepath.Join(*dir, fmt.Sprintf("share-%d", i+1))
+		if err := writeSecret(files[i], []byte(s+"\n")); err != nil {
+			return err
+		}
+	}
+	if c.opts.output == "text" {
+		for _, f := range files {
+			fmt.Fprintln(c.out, f)
+		}
+		return nil
+	}
+	return c.print(files)
+}
+
+// writeSecret writes data to new file readable only by the owner
+func writeSecret(name string, data []byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// runUnseal reads key shares from stdin, one per line, until the
+// key is combined, opens the store with it and runs command args.
+// The rest of stdin is the input of the command
+func runUnseal(c *cli, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: unseal COMMAND [ARGS]")
+	}
+	cmd := findCommand(args[0])
+	if cmd == nil || cmd.local {
+		return fmt.Errorf("unseal: %q is not a store command", args[0])
+	}
+	if err := checkOutput(c.opts.output); err != nil {
+		return err
+	}
+	u, err := svalkey.NewUnsealer(func(key [32]byte) (*svalkey.Store, error) {
+		return openKeyStore(&c.opts.storeOptions, key)
+	})
+	if err != nil {
+		return err
+	}
+	in := bufio.NewReader(c.in)
+	for c.store == nil {
+		line, err := in.ReadString('\n')
+		if line = strings.TrimSpace(line); line != "" {
+			if c.store, err = u.Add(line); err != nil {
+				return err
+			}
+			continue
+		}
+		if err == io.EOF {
+			added, threshold := u.Progress()
+			return fmt.Errorf("unseal: got %d of %d key shares", added, threshold)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	c.in = in
+	return cmd.run(c, args[1:])
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/abronan/valkeyrie"
+	"github.com/abronan/valkeyrie/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// memStore is in-memory backend registered as "mem"
+type memStore struct {
+	sync.Mutex
+	kv map[string][]byte
+}
+
+func init() {
+	valkeyrie.AddStore("mem", func(addrs []string, options *store.Config) (store.Store, error) {
+		return &memStore{kv: map[string][]byte{}}, nil
+	})
+}
+
+func (m *memStore) Put(key string, value []byte, options *store.WriteOptions) error {
+	m.Lock()
+	defer m.Unlock()
+	m.kv[key] = append([]byte(nil), value...)
+	return nil
+}
+
+func (m *memStore) Get(key string, options *store.ReadOptions) (*store.KVPair, error) {
+	m.Lock()
+	defer m.Unlock()
+	v, ok := m.kv[key]
+	if !ok {
+		return nil, store.ErrKeyNotFound
+	}
+	return &store.KVPair{Key: key, Value: v}, nil
+}
+
+func (m *memStore) Delete(key string) error {
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.kv[key]; !ok {
+		return store.ErrKeyNotFound
+	}
+	delete(m.kv, key)
+	return nil
+}
+
+func (m *memStore) Exists(key string, options *store.ReadOptions) (bool, error) {
+	m.Lock()
+	defer m.Unlock()
+	_, ok := m.kv[key]
+	return ok, nil
+}
+
+func (m *memStore) Watch(key string, stopCh <-chan struct{},
+	options *store.ReadOptions) (<-chan *store.KVPair, error) {
+	return nil, store.ErrCallNotSupported
+}
+
+func (m *memStore) WatchTree(directory string, stopCh <-chan struct{},
+	options *store.ReadOptions) (<-chan []*store.KVPair, error) {
+	return nil, store.ErrCallNotSupported
+}
+
+func (m *memStore) NewLock(key string, options *store.LockOptions) (store.Locker, error) {
+	return nil, store.ErrCallNotSupported
+}
+
+func (m *memStore) List(directory string, options *store.ReadOptions) ([]*store.KVPair, error) {
+	m.Lock()
+	defer m.Unlock()
+	pairs := []*store.KVPair{}
+	for k, v := range m.kv {
+		if strings.HasPrefix(k, directory) {
+			pairs = append(pairs, &store.KVPair{Key: k, Value: v})
+		}
+	}
+	if len(pairs) == 0 {
+		return nil, store.ErrKeyNotFound
+	}
+	return pairs, nil
+}
+
+func (m *memStore) DeleteTree(directory string) error {
+	m.Lock()
+	defer m.Unlock()
+	for k := range m.kv {
+		if strings.HasPrefix(k, directory) {
+			delete(m.kv, k)
+		}
+	}
+	return nil
+}
+
+func (m *memStore) AtomicPut(key string, value []byte, previous *store.KVPair,
+	options *store.WriteOptions) (bool, *store.KVPair, error) {
+	return false, nil, store.ErrCallNotSupported
+}
+
+func (m *memStore) AtomicDelete(key string, previous *store.KVPair) (bool, error) {
+	return false, store.ErrCallNotSupported
+}
+
+func (m *memStore) Close() {}
+
+// newTestCLI opens cli over mem backend with codec
+func newTestCLI(t *testing.T, codec, output string) (*cli, *bytes.Buffer) {
+	os.Setenv("SVALKEY_TEST_KEY", hex.EncodeToString(bytes.Repeat([]byte{7}, 32)))
+	opts := &options{output: output}
+	opts.storeOptions = defaultStoreOptions
+	opts.backend, opts.keyEnv, opts.codec = "mem", "SVALKEY_TEST_KEY", codec
+	c, err := newCLI(opts)
+	assert.Nil(t, err, "Err in newCLI must be nil")
+	out := &bytes.Buffer{}
+	c.out = out
+	return c, out
+}
+
+func TestCommands(t *testing.T) {
+	c, out := newTestCLI(t, "raw", "text")
+	defer c.close()
+
+	assert.Nil(t, runPut(c, []string{"app/a", "value a"}), "Err in put must be nil")
+	c.in = strings.NewReader("value b")
+	assert.Nil(t, runPut(c, []string{"app/b"}), "Err in put from stdin must be nil")
+	assert.NotNil(t, runPut(c, nil), "Err in put without key must not be nil")
+
+	assert.Nil(t, runGet(c, []string{"app/b"}), "Err in get must be nil")
+	assert.Equal(t, "value b", out.String(), "get must print value")
+	assert.NotNil(t, runGet(c, []string{"app/missing"}), "Err in get of missing key must not be nil")
+
+	out.Reset()
+	assert.Nil(t, runList(c, []string{"app/"}), "Err in ls must be nil")
+	lines := strings.Fields(out.String())
+	assert.ElementsMatch(t, []string{"app/a", "app/b"}, lines, "ls must print keys")
+
+	out.Reset()
+	assert.Nil(t, runExists(c, []string{"app/a"}), "Err in exists must be nil")
+	assert.Equal(t, "true\n", out.String(), "exists must print true")
+	assert.Equal(t, 0, c.status, "exists status must be 0")
+
+	assert.Nil(t, runDelete(c, []string{"app/a"}), "Err in rm must be nil")
+	out.Reset()
+	assert.Nil(t, runExists(c, []string{"app/a"}), "Err in exists must be nil")
+	assert.Equal(t, "false\n", out.String(), "exists must print false")
+	assert.Equal(t, 1, c.status, "exists status of missing key must be 1")
+
+	assert.Nil(t, runDelete(c, []string{"-r", "app/"}), "Err in rm -r must be nil")
+	assert.NotNil(t, runGet(c, []string{"app/b"}), "rm -r must delete keys under prefix")
+}
+
+func TestCommandsJSON(t *testing.T) {
+	c, out := newTestCLI(t, "json", "json")
+	defer c.close()
+
+	assert.Nil(t, runPut(c, []string{"a", `{"n": 1}`}), "Err in put must be nil")
+	assert.NotNil(t, runPut(c, []string{"b", `{`}), "Err in put of invalid JSON must not be nil")
+	assert.Nil(t, runGet(c, []string{"a"}), "Err in get must be nil")
+	assert.JSONEq(t, `{"key": "a", "value": {"n": 1}}`, out.String(), "get must print entry")
+
+	out.Reset()
+	assert.Nil(t, runList(c, nil), "Err in ls must be nil")
+	assert.JSONEq(t, `[{"key": "a", "value": {"n": 1}}]`, out.String(), "ls must print entries")
+
+	out.Reset()
+	assert.Nil(t, runExists(c, []string{"a"}), "Err in exists must be nil")
+	assert.JSONEq(t, `{"key": "a", "exists": true}`, out.String(), "exists must print result")
+}
+
+func TestSplitUnseal(t *testing.T) {
+	c, out := newTestCLI(t, "raw", "text")
+	c.close()
+	dir, err := ioutil.TempDir("", "shares")
+	assert.Nil(t, err, "Err in TempDir must be nil")
+	defer os.RemoveAll(dir)
+
+	assert.NotNil(t, runSplit(c, []string{"-n", "3", "-k", "2"}), "Err in split without -out-dir must not be nil")
+	assert.Nil(t, runSplit(c, []string{"-n", "3", "-k", "2", "-out-dir", dir}), "Err in split must be nil")
+	files := strings.Fields(out.String())
+	assert.Equal(t, []string{filepath.Join(dir, "share-1"), filepath.Join(dir, "share-2"),
+		filepath.Join(dir, "share-3")}, files, "split must print share files")
+	for _, f := range files {
+		fi, err := os.Stat(f)
+		assert.Nil(t, err, "Err in Stat must be nil")
+		assert.Equal(t, os.FileMode(0600), fi.Mode().Perm(), "Share file must be readable only by owner")
+	}
+	assert.NotNil(t, runSplit(c, []string{"-out-dir", dir}), "split must not overwrite shares")
+
+	share := func(i int) string {
+		data, err := ioutil.ReadFile(files[i])
+		assert.Nil(t, err, "Err in ReadFile must be nil")
+		return string(data)
+	}
+	u := &cli{opts: c.opts, out: &bytes.Buffer{}}
+	u.in = strings.NewReader(share(0))
+	assert.NotNil(t, runUnseal(u, []string{"put", "a"}), "Err in unseal with too few shares must not be nil")
+	assert.NotNil(t, runUnseal(u, []string{"split"}), "Err in unseal of local command must not be nil")
+	assert.NotNil(t, runUnseal(u, nil), "Err in unseal without command must not be nil")
+
+	u.in = strings.NewReader(share(2) + "\n" + share(0) + "value a")
+	assert.Nil(t, runUnseal(u, []string{"put", "a"}), "Err in unseal must be nil")
+	defer u.close()
+	data, err := u.store.GetBytes("a", nil)
+	assert.Nil(t, err, "Err in GetBytes must be nil")
+	assert.Equal(t, "value a", string(data), "unseal must pass the rest of stdin to command")
+	assert.NotContains(t, u.out.(*bytes.Buffer).String(), hex.EncodeToString(bytes.Repeat([]byte{7}, 32)),
+		"unseal must not print the key")
+}
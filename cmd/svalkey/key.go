@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/karantin2020/svalkey"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// loadKey reads the master key from key file, possibly encrypted
+// with password, shares file, key command, environment
+// or derives it from a password prompted on terminal
+func loadKey(opts *storeOptions) (key [32]byte, err error) {
+	switch {
+	case opts.password && opts.keyFile != "":
+		return key, fmt.Errorf("-password can't be used with -key-file," +
+			" use -key-file-password to decrypt the key file")
+	case opts.keyFilePassword:
+		if opts.keyFile == "" {
+			return key, fmt.Errorf("-key-file-password requires -key-file")
+		}
+		p := &svalkey.PassphraseKeyProvider{Path: opts.keyFile, Passphrase: readPassword}
+		return p.Key()
+	case opts.password:
+		if opts.salt == "" {
+			return key, fmt.Errorf("-password requires -salt, use a random value unique to the store")
+		}
+		pw, err := readPassword()
+		if err != nil {
+			return key, err
+		}
+		return passwordKey(pw, []byte(opts.salt)), nil
+	case opts.sharesFile != "":
+		data, err := ioutil.ReadFile(opts.sharesFile)
+		if err != nil {
+			return key, fmt.Errorf("read shares file: %v", err)
+		}
+		return svalkey.CombineKeyShares(readShares(data))
+	case opts.keyFile != "":
+		p := &svalkey.FileKeyProvider{Path: opts.keyFile}
+		if key, err = p.Key(); err != nil {
+			return key, fmt.Errorf("read key file: %v", err)
+		}
+		return key, nil
+	case opts.keyCmd != "":
+		args := strings.Fields(opts.keyCmd)
+		if len(args) == 0 {
+			return key, fmt.Errorf("-key-cmd is empty, set the command which prints the key")
+		}
+		p := &svalkey.ExecKeyProvider{Command: args[0], Args: args[1:]}
+		return p.Key()
+	case os.Getenv(opts.keyEnv) != "":
+		p := &svalkey.EnvKeyProvider{Name: opts.keyEnv}
+		return p.Key()
+	}
+	return key, fmt.Errorf("no key: set -key-file, -shares-file, -key-cmd, -password or %s", opts.keyEnv)
+}
+
+// readPassword prompts password on terminal
+func readPassword() ([]byte, error) {
+	fmt.Fprint(os.Stderr, "Password: ")
+	pw, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("read password: %v", err)
+	}
+	return pw, nil
+}
+
+// readShares returns non-empty lines of data
+func readShares(data []byte) []string {
+	shares := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			shares = append(shares, line)
+		}
+	}
+	return shares
+}
+
+// passwordKey derives the master key from password using Argon2id
+func passwordKey(password, salt []byte) (key [32]byte) {
+	copy(key[:], argon2.IDKey(password, salt, 1, 64*1024, 4, 32))
+	return key
+}
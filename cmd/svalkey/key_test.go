@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/karantin2020/svalkey"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadKeyShares(t *testing.T) {
+	var want [32]byte
+	copy(want[:], bytes.Repeat([]byte{0x5a}, 32))
+	shares, err := svalkey.SplitKey(want, 3, 2)
+	assert.Nil(t, err, "Err in SplitKey must be nil")
+	f, err := ioutil.TempFile("", "shares")
+	assert.Nil(t, err, "Err in TempFile must be nil")
+	defer os.Remove(f.Name())
+	f.WriteString("\n" + shares[2] + "\n\n" + shares[0] + "\n")
+	f.Close()
+
+	key, err := loadKey(&storeOptions{sharesFile: f.Name()})
+	assert.Nil(t, err, "Err in loadKey must be nil")
+	assert.Equal(t, want, key)
+}
+
+func TestLoadKeyPassword(t *testing.T) {
+	_, err := loadKey(&storeOptions{password: true})
+	assert.NotNil(t, err, "Err in loadKey of password without salt must not be nil")
+}
+
+func TestLoadKeyUsage(t *testing.T) {
+	_, err := loadKey(&storeOptions{keyCmd: " "})
+	assert.NotNil(t, err, "Err in loadKey of empty key command must not be nil")
+	_, err = loadKey(&storeOptions{password: true, salt: "salt", keyFile: "key"})
+	assert.NotNil(t, err, "Err in loadKey of -password with -key-file must not be nil")
+	_, err = loadKey(&storeOptions{keyFilePassword: true})
+	assert.NotNil(t, err, "Err in loadKey of -key-file-password without -key-file must not be nil")
+}
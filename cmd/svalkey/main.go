@@ -0,0 +1,183 @@
+// Command svalkey puts, gets, lists and deletes encrypted values
+// in any backend supported by valkeyrie.
+//
+// Usage:
+//
+//	svalkey [flags] put KEY [VALUE]
+//	svalkey [flags] get KEY
+//	svalkey [flags] ls [PREFIX]
+//	svalkey [flags] rm [-r] KEY
+//	svalkey [flags] exists KEY
+//	svalkey [flags] migrate [-to-FLAG ...] [-reencrypt] [PREFIX]
+//	svalkey [flags] verify [-decode] [PREFIX]
+//	svalkey [flags] split [-n N] [-k K] -out-dir DIR
+//	svalkey [flags] unseal COMMAND [ARGS]
+//
+// The value of put is read from stdin if it is omitted.
+//
+// The master key is read from -key-file, combined from Shamir key
+// shares in -shares-file, printed by -key-cmd, read from the
+// environment variable named by -key-env or derived from -salt and
+// a password prompted on terminal when -password is set. A key file
+// written by WritePassphraseKeyFile is decrypted with a password
+// prompted on terminal when -key-file-password is set.
+//
+// split writes N shares of the master key to files share-1 ... share-N
+// in DIR, any K of them unseal it. unseal reads shares from stdin, one
+// per line, opens the store with the key combined from them and runs
+// COMMAND, the rest of stdin is its input. The key is never printed.
+//
+// Run "svalkey migrate -h" to see flags of the destination store,
+// they default to the source ones.
+//
+// Exit status is 2 on error. exists exits with status 1 if the key
+// doesn't exist, migrate if some values were not copied, verify
+// if some entries are unreadable or orphaned.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// storeOptions holds settings to open a store
+type storeOptions struct {
+	backend         string
+	addrs           string
+	bucket          string
+	timeout         time.Duration
+	keyFile         string
+	sharesFile      string
+	keyCmd          string
+	keyEnv          string
+	password        bool
+	keyFilePassword bool
+	salt            string
+	codec           string
+	chunkSize       int
+}
+
+type options struct {
+	storeOptions
+	output string
+}
+
+// register defines flags of store options in fs. Flag names are
+// prefixed with prefix, default values are taken from defaults
+func (o *storeOptions) register(fs *flag.FlagSet, prefix string, defaults *storeOptions) {
+	fs.StringVar(&o.backend, prefix+"backend", defaults.backend,
+		"backend store: boltdb, consul, etcd, etcdv3, redis or zk")
+	fs.StringVar(&o.addrs, prefix+"addr", defaults.addrs,
+		"comma separated backend endpoints, or database path for boltdb")
+	fs.StringVar(&o.bucket, prefix+"bucket", defaults.bucket, "boltdb bucket")
+	fs.DurationVar(&o.timeout, prefix+"timeout", defaults.timeout, "backend connection timeout")
+	fs.StringVar(&o.keyFile, prefix+"key-file", defaults.keyFile,
+		"file with raw, hex or base64 encoded 32 byte key")
+	fs.StringVar(&o.sharesFile, prefix+"shares-file", defaults.sharesFile,
+		"file with key shares made by split, one per line")
+	fs.StringVar(&o.keyCmd, prefix+"key-cmd", defaults.keyCmd,
+		"command which prints hex or base64 encoded 32 byte key")
+	fs.StringVar(&o.keyEnv, prefix+"key-env", defaults.keyEnv,
+		"environment variable with hex or base64 encoded 32 byte key")
+	fs.BoolVar(&o.password, prefix+"password", defaults.password,
+		"derive key from password prompted on terminal")
+	fs.BoolVar(&o.keyFilePassword, prefix+"key-file-password", defaults.keyFilePassword,
+		"decrypt -key-file made by WritePassphraseKeyFile\nwith password prompted on terminal")
+	fs.StringVar(&o.salt, prefix+"salt", defaults.salt,
+		"salt for password key derivation, required with -password,\nuse a random value unique to the store")
+	fs.StringVar(&o.codec, prefix+"codec", defaults.codec, "value codec: raw, json, gob or xml")
+	fs.IntVar(&o.chunkSize, prefix+"chunk-size", defaults.chunkSize,
+		"split values larger than size bytes into chunks")
+}
+
+var defaultStoreOptions = storeOptions{
+	backend: "boltdb",
+	addrs:   "svalkey.db",
+	bucket:  "svalkey",
+	timeout: 10 * time.Second,
+	keyEnv:  "SVALKEY_KEY",
+	codec:   "raw",
+}
+
+type command struct {
+	name  string
+	usage string
+	run   func(c *cli, args []string) error
+	// local commands don't open the store
+	local bool
+}
+
+// commands are set in init, unseal looks them up
+var commands []command
+
+func init() {
+	commands = []command{
+		{"put", "put KEY [VALUE]\tput VALUE (or stdin) at KEY", runPut, false},
+		{"get", "get KEY\tprint value at KEY", runGet, false},
+		{"ls", "ls [PREFIX]\tlist keys and values under PREFIX", runList, false},
+		{"rm", "rm [-r] KEY\tdelete KEY, or all keys under KEY with -r", runDelete, false},
+		{"exists", "exists KEY\tprint whether KEY exists, exit status 1 if not", runExists, false},
+		{"migrate", "migrate [PREFIX]\tcopy values under PREFIX to store set by -to-* flags", runMigrate, false},
+		{"verify", "verify [PREFIX]\tcheck that values under PREFIX are authentic and readable", runVerify, false},
+		{"split", "split [-n N] [-k K] -out-dir DIR\twrite N shares of the key to DIR, any K of them unseal it", runSplit, true},
+		{"unseal", "unseal COMMAND [ARGS]\trun COMMAND with key combined from shares read from stdin", runUnseal, true},
+	}
+}
+
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+func main() {
+	var opts options
+	fs := flag.NewFlagSet("svalkey", flag.ExitOnError)
+	opts.register(fs, "", &defaultStoreOptions)
+	fs.StringVar(&opts.output, "o", "text", "output format: text, json or yaml")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: svalkey [flags] COMMAND [ARGS]\n\nCommands:\n")
+		for _, c := range commands {
+			u := strings.SplitN(c.usage, "\t", 2)
+			fmt.Fprintf(fs.Output(), "  %-34s%s\n", u[0], u[1])
+		}
+		fmt.Fprintf(fs.Output(), "\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[1:])
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	name, args := fs.Arg(0), fs.Args()[1:]
+	c := findCommand(name)
+	if c == nil {
+		fmt.Fprintf(os.Stderr, "svalkey: unknown command %q\n", name)
+		fs.Usage()
+		os.Exit(2)
+	}
+	cl := &cli{opts: &opts, in: os.Stdin, out: os.Stdout}
+	if !c.local {
+		var err error
+		if cl, err = newCLI(&opts); err != nil {
+			fatal(err)
+		}
+	}
+	err := c.run(cl, args)
+	cl.close()
+	if err != nil {
+		fatal(err)
+	}
+	os.Exit(cl.status)
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "svalkey: %v\n", err)
+	os.Exit(2)
+}
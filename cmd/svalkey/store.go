@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/abronan/valkeyrie"
+	"github.com/abronan/valkeyrie/store"
+	"github.com/abronan/valkeyrie/store/boltdb"
+	"github.com/abronan/valkeyrie/store/consul"
+	etcdv2 "github.com/abronan/valkeyrie/store/etcd/v2"
+	etcdv3 "github.com/abronan/valkeyrie/store/etcd/v3"
+	"github.com/abronan/valkeyrie/store/redis"
+	"github.com/abronan/valkeyrie/store/zookeeper"
+	"github.com/karantin2020/svalkey"
+	"github.com/karantin2020/svalkey/types"
+	"github.com/minio/sio"
+)
+
+func init() {
+	boltdb.Register()
+	consul.Register()
+	etcdv2.Register()
+	etcdv3.Register()
+	redis.Register()
+	zookeeper.Register()
+}
+
+var cipherSuites = []byte{sio.AES_256_GCM, sio.CHACHA20_POLY1305}
+
+// cli holds opened store, command input and output settings
+type cli struct {
+	opts   *options
+	store  *svalkey.Store
+	in     io.Reader
+	out    io.Writer
+	status int
+}
+
+func newCLI(opts *options) (*cli, error) {
+	if err := checkOutput(opts.output); err != nil {
+		return nil, err
+	}
+	st, err := openStore(&opts.storeOptions)
+	if err != nil {
+		return nil, err
+	}
+	return &cli{opts: opts, store: st, in: os.Stdin, out: os.Stdout}, nil
+}
+
+func checkOutput(output string) error {
+	switch output {
+	case "text", "json", "yaml":
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q", output)
+}
+
+func (c *cli) close() {
+	if c.store != nil {
+		c.store.Close()
+	}
+}
+
+// openStore opens backend store and creates svalkey store over it
+func openStore(opts *storeOptions) (*svalkey.Store, error) {
+	key, err := loadKey(opts)
+	if err != nil {
+		return nil, err
+	}
+	return openKeyStore(opts, key)
+}
+
+// openKeyStore opens backend store and creates svalkey store
+// with key over it
+func openKeyStore(opts *storeOptions, key [32]byte) (*svalkey.Store, error) {
+	codec, err := newCodec(opts.codec)
+	if err != nil {
+		return nil, err
+	}
+	addrs := strings.Split(opts.addrs, ",")
+	if store.Backend(opts.backend) == store.BOLTDB {
+		// boltdb creates the database directory, so it must not be empty
+		for i := range addrs {
+			if addrs[i], err = filepath.Abs(addrs[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	kv, err := valkeyrie.NewStore(store.Backend(opts.backend), addrs,
+		&store.Config{
+			ConnectionTimeout: opts.timeout,
+			Bucket:            opts.bucket,
+			PersistConnection: true,
+		})
+	if err != nil {
+		return nil, fmt.Errorf("open %s backend: %v", opts.backend, err)
+	}
+	st, err := svalkey.NewCustomStore(kv, codec, cipherSuites, key)
+	if err != nil {
+		kv.Close()
+		return nil, err
+	}
+	st.SetChunkSize(opts.chunkSize)
+	return st, nil
+}
+
+func newCodec(name string) (types.Codec, error) {
+	switch name {
+	case "raw":
+		return svalkey.RawCodec{}, nil
+	case "json":
+		return svalkey.JSONCodec{}, nil
+	case "gob":
+		return svalkey.GobCodec{}, nil
+	case "xml":
+		return svalkey.XMLCodec{}, nil
+	}
+	return nil, fmt.Errorf("unknown codec %q", name)
+}
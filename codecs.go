@@ -4,7 +4,9 @@ import (
 	"encoding/gob"
 	"encoding/json"
 	"encoding/xml"
+	"fmt"
 	"io"
+	"io/ioutil"
 
 	"github.com/karantin2020/svalkey/types"
 )
@@ -13,6 +15,7 @@ var (
 	_ types.Codec = XMLCodec{}
 	_ types.Codec = JSONCodec{}
 	_ types.Codec = GobCodec{}
+	_ types.Codec = RawCodec{}
 )
 
 // XMLCodec is used to encode/decode XML
@@ -65,3 +68,58 @@ func (c GobCodec) NewEncoder(w io.Writer) types.Encoder {
 func (c GobCodec) NewDecoder(r io.Reader) types.Decoder {
 	return gob.NewDecoder(r)
 }
+
+// RawCodec is used to store []byte and string values verbatim.
+// Encode accepts []byte, string and pointers to them,
+// Decode accepts *[]byte and *string
+type RawCodec struct{}
+
+type rawEncoder struct {
+	w io.Writer
+}
+
+type rawDecoder struct {
+	r io.Reader
+}
+
+// NewEncoder returns a new raw encoder which writes to w
+func (c RawCodec) NewEncoder(w io.Writer) types.Encoder {
+	return rawEncoder{w}
+}
+
+// NewDecoder returns a new raw decoder which reads from r
+func (c RawCodec) NewDecoder(r io.Reader) types.Decoder {
+	return rawDecoder{r}
+}
+
+func (e rawEncoder) Encode(v interface{}) (err error) {
+	switch val := v.(type) {
+	case []byte:
+		_, err = e.w.Write(val)
+	case *[]byte:
+		_, err = e.w.Write(*val)
+	case string:
+		_, err = io.WriteString(e.w, val)
+	case *string:
+		_, err = io.WriteString(e.w, *val)
+	default:
+		err = fmt.Errorf("svalkey: RawCodec can't encode %T", v)
+	}
+	return err
+}
+
+func (d rawDecoder) Decode(v interface{}) error {
+	data, err := ioutil.ReadAll(d.r)
+	if err != nil {
+		return err
+	}
+	switch val := v.(type) {
+	case *[]byte:
+		*val = data
+	case *string:
+		*val = string(data)
+	default:
+		return fmt.Errorf("svalkey: RawCodec can't decode into %T", v)
+	}
+	return nil
+}
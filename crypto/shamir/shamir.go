@@ -0,0 +1,141 @@
+// Package shamir implements Shamir's secret sharing over GF(2^8).
+// A secret is split into n shares, any k of them reconstruct it
+// and fewer reveal nothing about it.
+//
+// Share layout is the secret length y values followed by
+// x coordinate byte of the share
+package shamir
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"io"
+)
+
+var (
+	// ErrInvalidParams describes invalid shares number or threshold error
+	ErrInvalidParams = fmt.Errorf("shamir: threshold must be at least 2" +
+		" and not more than number of shares, which is at most 255")
+	// ErrEmptySecret describes empty secret error
+	ErrEmptySecret = fmt.Errorf("shamir: secret is empty")
+	// ErrInvalidShares describes malformed or duplicated shares error
+	ErrInvalidShares = fmt.Errorf("shamir: shares are malformed," +
+		" differ in length or duplicated")
+)
+
+// exp and log tables of GF(2^8) with generator 3
+// and polynomial x^8 + x^4 + x^3 + x + 1
+var expTable, logTable [256]byte
+
+func init() {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		expTable[i] = x
+		logTable[x] = byte(i)
+		// multiply by generator 3
+		hi := x & 0x80
+		x2 := x << 1
+		if hi != 0 {
+			x2 ^= 0x1b
+		}
+		x ^= x2
+	}
+	expTable[255] = expTable[0]
+}
+
+func mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTable[(int(logTable[a])+int(logTable[b]))%255]
+}
+
+func div(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return expTable[(int(logTable[a])-int(logTable[b])+255)%255]
+}
+
+// eval evaluates polynomial with coefficients coeffs
+// (constant term first) at x
+func eval(coeffs []byte, x byte) byte {
+	y := byte(0)
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		y = mul(y, x) ^ coeffs[i]
+	}
+	return y
+}
+
+// Split splits secret into n shares, any k of them
+// reconstruct the secret
+func Split(secret []byte, n, k int) ([][]byte, error) {
+	if k < 2 || k > n || n > 255 {
+		return nil, ErrInvalidParams
+	}
+	if len(secret) == 0 {
+		return nil, ErrEmptySecret
+	}
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][len(secret)] = byte(i + 1)
+	}
+	coeffs := make([]byte, k)
+	defer zero(coeffs)
+	for j, s := range secret {
+		coeffs[0] = s
+		if _, err := io.ReadFull(rand.Reader, coeffs[1:]); err != nil {
+			return nil, fmt.Errorf("shamir: error read random coefficients; %s", err.Error())
+		}
+		for i := range shares {
+			shares[i][j] = eval(coeffs, byte(i+1))
+		}
+	}
+	return shares, nil
+}
+
+// Combine reconstructs secret from shares. At least threshold
+// shares must be passed, otherwise the result is garbage
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, ErrInvalidShares
+	}
+	size := len(shares[0])
+	if size < 2 {
+		return nil, ErrInvalidShares
+	}
+	xs := make([]byte, len(shares))
+	for i, s := range shares {
+		if len(s) != size || s[size-1] == 0 {
+			return nil, ErrInvalidShares
+		}
+		xs[i] = s[size-1]
+		for _, x := range xs[:i] {
+			if subtle.ConstantTimeByteEq(x, xs[i]) == 1 {
+				return nil, ErrInvalidShares
+			}
+		}
+	}
+	secret := make([]byte, size-1)
+	for i := range shares {
+		// Lagrange basis polynomial of share i at 0
+		basis := byte(1)
+		for j := range shares {
+			if i != j {
+				basis = mul(basis, div(xs[j], xs[i]^xs[j]))
+			}
+		}
+		for b := range secret {
+			secret[b] ^= mul(shares[i][b], basis)
+		}
+	}
+	return secret, nil
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,50 @@
+package shamir
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitCombine(t *testing.T) {
+	secret := []byte("32 byte master key of svalkey!!!")
+	shares, err := Split(secret, 5, 3)
+	assert.Nil(t, err, "Err in Split must be nil")
+	assert.Equal(t, 5, len(shares), "Split must return n shares")
+
+	for _, set := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		subset := [][]byte{}
+		for _, i := range set {
+			subset = append(subset, shares[i])
+		}
+		out, err := Combine(subset)
+		assert.Nil(t, err, "Err in Combine must be nil")
+		assert.Equal(t, secret, out, "Combine of %v must return secret", set)
+	}
+	out, err := Combine(shares[:2])
+	assert.Nil(t, err, "Err in Combine must be nil")
+	assert.False(t, bytes.Equal(secret, out), "Combine below threshold must not return secret")
+
+	_, err = Combine([][]byte{shares[0], shares[0]})
+	assert.Equal(t, ErrInvalidShares, err, "Duplicated shares must fail")
+	_, err = Combine([][]byte{shares[0], shares[1][:5]})
+	assert.Equal(t, ErrInvalidShares, err, "Shares of different length must fail")
+	for _, p := range [][2]int{{1, 1}, {2, 3}, {256, 2}} {
+		_, err = Split(secret, p[0], p[1])
+		assert.Equal(t, ErrInvalidParams, err, "Split(%d, %d) must fail", p[0], p[1])
+	}
+	_, err = Split(nil, 3, 2)
+	assert.Equal(t, ErrEmptySecret, err, "Split of empty secret must fail")
+}
+
+func TestField(t *testing.T) {
+	for a := 1; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			p := mul(byte(a), byte(b))
+			if div(p, byte(b)) != byte(a) {
+				t.Fatalf("div(mul(%d, %d), %d) != %d", a, b, b, a)
+			}
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package svalkey
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// envelopeMagic prefixes values which have an envelope header.
+// Legacy values start with a random 32 byte nonce
+var envelopeMagic = []byte("SVKENV01")
+
+const maxHeaderSize = 1<<16 - 1
+
+// Envelope header field tags
+const (
+	tagSchema     byte = 0x01
+	tagPrimer     byte = 0x02
+	tagEphemeral  byte = 0x03
+	tagRecipients byte = 0x04
+)
+
+// ErrEnvelope represents malformed value envelope error
+var ErrEnvelope = fmt.Errorf("svalkey: malformed value envelope")
+
+// header holds value envelope fields.
+//
+// The value layout is:
+//
+//	magic | header length | header | nonce | encrypted data
+//	  8          2             n      32     ~ len(data)
+//
+// Header is a sequence of fields: tag | length (uvarint) | data.
+// Magic and header bytes are used as HKDF info for the value key
+// derivation, so header fields are authenticated with the encrypted data.
+// Recipient stanzas are excluded from the info, so they can be
+// replaced without re-encryption of the value, see AddRecipients.
+// Legacy values consist of nonce and encrypted data only
+type header struct {
+	legacy bool
+	schema uint32
+	primer []byte
+	// ephemeral is X25519 public key of sealed value
+	ephemeral []byte
+	// recipients holds stanzas which wrap data key of the value
+	recipients []byte
+}
+
+func (h *header) marshal() []byte {
+	var buf bytes.Buffer
+	if h.schema != 0 {
+		var v [4]byte
+		binary.BigEndian.PutUint32(v[:], h.schema)
+		writeField(&buf, tagSchema, v[:])
+	}
+	if len(h.primer) > 0 {
+		writeField(&buf, tagPrimer, h.primer)
+	}
+	if len(h.ephemeral) > 0 {
+		writeField(&buf, tagEphemeral, h.ephemeral)
+	}
+	if len(h.recipients) > 0 {
+		writeField(&buf, tagRecipients, h.recipients)
+	}
+	return buf.Bytes()
+}
+
+func writeField(buf *bytes.Buffer, tag byte, data []byte) {
+	var l [binary.MaxVarintLen64]byte
+	buf.WriteByte(tag)
+	buf.Write(l[:binary.PutUvarint(l[:], uint64(len(data)))])
+	buf.Write(data)
+}
+
+func unmarshalHeader(data []byte) (*header, error) {
+	h := &header{}
+	for len(data) > 0 {
+		tag := data[0]
+		l, n := binary.Uvarint(data[1:])
+		if n <= 0 || uint64(len(data)-1-n) < l {
+			return nil, ErrEnvelope
+		}
+		field := data[1+n : 1+n+int(l)]
+		data = data[1+n+int(l):]
+		switch tag {
+		case tagSchema:
+			if len(field) != 4 {
+				return nil, ErrEnvelope
+			}
+			h.schema = binary.BigEndian.Uint32(field)
+		case tagPrimer:
+			if len(field) != primerIDSize {
+				return nil, ErrEnvelope
+			}
+			h.primer = field
+		case tagEphemeral:
+			if len(field) != 32 {
+				return nil, ErrEnvelope
+			}
+			h.ephemeral = field
+		case tagRecipients:
+			if len(field) == 0 {
+				return nil, ErrEnvelope
+			}
+			h.recipients = field
+		default:
+			return nil, fmt.Errorf("svalkey: unsupported envelope field %#x", tag)
+		}
+	}
+	return h, nil
+}
+
+// writeHeader writes envelope magic and header into w
+// and returns key derivation info
+func writeHeader(w io.Writer, h *header) ([]byte, error) {
+	hb := h.marshal()
+	if len(hb) > maxHeaderSize {
+		return nil, fmt.Errorf("svalkey: envelope header is too large")
+	}
+	var l [2]byte
+	binary.BigEndian.PutUint16(l[:], uint16(len(hb)))
+	if _, err := w.Write(envelopeMagic); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(l[:]); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(hb); err != nil {
+		return nil, err
+	}
+	return headerInfo(hb), nil
+}
+
+// headerInfo returns key derivation info of header bytes hb:
+// magic and header fields except recipient stanzas
+func headerInfo(hb []byte) []byte {
+	info := append([]byte{}, envelopeMagic...)
+	for len(hb) > 0 {
+		l, n := binary.Uvarint(hb[1:])
+		if n <= 0 || uint64(len(hb)-1-n) < l {
+			return append(info, hb...)
+		}
+		size := 1 + n + int(l)
+		if hb[0] != tagRecipients {
+			info = append(info, hb[:size]...)
+		}
+		hb = hb[size:]
+	}
+	return info
+}
+
+// readHeader reads envelope header from r and returns it with
+// key derivation info. For legacy values it returns legacy header,
+// nil info and reader which starts with nonce
+func readHeader(r io.Reader) (*header, []byte, io.Reader, error) {
+	magic := make([]byte, len(envelopeMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, nil, nil, ErrEnvelope
+	}
+	if !bytes.Equal(magic, envelopeMagic) {
+		return &header{legacy: true}, nil, io.MultiReader(bytes.NewReader(magic), r), nil
+	}
+	var l [2]byte
+	if _, err := io.ReadFull(r, l[:]); err != nil {
+		return nil, nil, nil, ErrEnvelope
+	}
+	hb := make([]byte, binary.BigEndian.Uint16(l[:]))
+	if _, err := io.ReadFull(r, hb); err != nil {
+		return nil, nil, nil, ErrEnvelope
+	}
+	h, err := unmarshalHeader(hb)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return h, headerInfo(hb), r, nil
+}
@@ -0,0 +1,96 @@
+package svalkey
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+var (
+	// ErrStoreClosed represents operation on closed Store error
+	ErrStoreClosed = fmt.Errorf("svalkey: in Store operation" +
+		" store is closed")
+)
+
+// keyBuffer holds the Store key. Where the platform allows, the key
+// lives outside of Go heap in memory locked in RAM and surrounded
+// by inaccessible guard pages, so it is never swapped, moved by GC
+// or read by overflow of the neighbour buffer. Otherwise the key
+// lives in Go heap.
+//
+// Operations hold the buffer while they use the key, destroy
+// waits for them and zeroes the key. The memory is zeroed and
+// released by finalizer, so stale readers see zero key instead
+// of fault
+type keyBuffer struct {
+	key    *[32]byte
+	region []byte
+
+	mu     sync.Mutex
+	idle   *sync.Cond
+	active int
+	closed bool
+}
+
+// newKeyBuffer copies key into new keyBuffer and zeroes key
+func newKeyBuffer(key *[32]byte) *keyBuffer {
+	k := &keyBuffer{}
+	k.idle = sync.NewCond(&k.mu)
+	if b, region, err := allocGuarded(len(key)); err == nil {
+		k.key = (*[32]byte)(b)
+		k.region = region
+	} else {
+		k.key = new([32]byte)
+	}
+	runtime.SetFinalizer(k, (*keyBuffer).free)
+	*k.key = *key
+	zeroBytes(key[:])
+	return k
+}
+
+// locked reports if the key is held in locked memory
+func (k *keyBuffer) locked() bool {
+	return k.region != nil
+}
+
+// acquire marks the key as used. It returns ErrStoreClosed
+// after destroy. Every successful acquire must be released
+func (k *keyBuffer) acquire() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.closed {
+		return ErrStoreClosed
+	}
+	k.active++
+	return nil
+}
+
+func (k *keyBuffer) release() {
+	k.mu.Lock()
+	k.active--
+	if k.active == 0 {
+		k.idle.Broadcast()
+	}
+	k.mu.Unlock()
+}
+
+// destroy waits until the key is released and zeroes it.
+// It reports false if the key was already destroyed
+func (k *keyBuffer) destroy() bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.closed {
+		return false
+	}
+	k.closed = true
+	for k.active > 0 {
+		k.idle.Wait()
+	}
+	zeroBytes(k.key[:])
+	return true
+}
+
+func (k *keyBuffer) free() {
+	zeroBytes(k.key[:])
+	freeGuarded(k.region)
+}
@@ -0,0 +1,133 @@
+package svalkey
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore_Close(t *testing.T) {
+	key := [32]byte{1, 2, 3}
+	m := NewMock()
+	st, err := NewCustomStore(m, JSONCodec{}, []byte{1, 0}, key)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	if runtime.GOOS == "linux" && !st.KeyLocked() {
+		t.Log("memory lock limit is exceeded, key is held in Go heap")
+	}
+	assert.Equal(t, key, *st.key, "Store must hold the key")
+	scoped, err := st.Scoped("app")
+	assert.Nil(t, err, "Err in Scoped must be nil")
+	assert.Nil(t, st.Put("a", TestType{C: "a"}, nil), "Err in Put must be nil")
+
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	st.Use(func(next Handler) Handler {
+		return func(op *Operation) error {
+			if op.Key == "slow" {
+				close(started)
+				<-finish
+			}
+			return next(op)
+		}
+	})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.Nil(t, st.Put("slow", TestType{C: "slow"}, nil), "Err in running Put must be nil")
+	}()
+	<-started
+	closed := make(chan struct{})
+	go func() {
+		st.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("Close must wait for running operations")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(finish)
+	<-closed
+	wg.Wait()
+
+	assert.True(t, m.closed, "Close must close backend")
+	assert.Equal(t, [32]byte{}, *st.key, "Close must zero the key")
+	st.Close()
+	st.WithContext(nil).Close()
+	out := TestType{}
+	assert.Equal(t, ErrStoreClosed, st.Get("a", &out, nil), "Get of closed Store must fail")
+	assert.Equal(t, ErrStoreClosed, st.Put("b", TestType{}, nil), "Put of closed Store must fail")
+	_, err = st.Scoped("other")
+	assert.Equal(t, ErrStoreClosed, err, "Scoped of closed Store must fail")
+
+	assert.NotEqual(t, [32]byte{}, *scoped.key, "Scoped Store must keep its own key")
+}
+
+func TestStore_CloseConcurrent(t *testing.T) {
+	st, err := NewCustomStore(NewMock(), JSONCodec{}, []byte{1, 0}, [32]byte{1})
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			err := st.Put(string(rune('a'+i)), TestType{C: "a"}, nil)
+			assert.True(t, err == nil || err == ErrStoreClosed,
+				"Put must succeed or fail with ErrStoreClosed")
+		}(i)
+		go func() {
+			defer wg.Done()
+			st.Close()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, [32]byte{}, *st.key, "Close must zero the key")
+}
+
+func TestStore_CloseScoped(t *testing.T) {
+	m := NewMock()
+	st, err := NewCustomStore(m, JSONCodec{}, []byte{1, 0}, [32]byte{1})
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	scoped, err := st.Scoped("app")
+	assert.Nil(t, err, "Err in Scoped must be nil")
+	assert.Nil(t, scoped.Put("app/a", TestType{C: "a"}, nil), "Err in Put must be nil")
+	scoped.Close()
+
+	assert.False(t, m.closed, "Close of scoped Store must not close backend")
+	assert.Equal(t, [32]byte{}, *scoped.key, "Close must zero the key of scoped Store")
+	assert.Equal(t, ErrStoreClosed, scoped.Put("app/b", TestType{}, nil),
+		"Put of closed scoped Store must fail")
+	assert.Nil(t, st.Put("b", TestType{C: "b"}, nil), "Err in Put of parent Store must be nil")
+	out := TestType{}
+	assert.Nil(t, st.Get("b", &out, nil), "Err in Get of parent Store must be nil")
+	assert.Equal(t, "b", out.C, "Get must return put value")
+	st.Close()
+	assert.True(t, m.closed, "Close of parent Store must close backend")
+}
+
+func TestStore_CloseSecrets(t *testing.T) {
+	m := rewriteMock{NewMock()}
+	_, private, err := GenerateSealKeys()
+	assert.Nil(t, err, "Err in GenerateSealKeys must be nil")
+	st, err := NewCustomStore(m, JSONCodec{}, []byte{1, 0}, [32]byte{1})
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	st.SetPrivateKey(private)
+	st.SetRecipients(SymmetricRecipient([32]byte{2}))
+	assert.Equal(t, [32]byte{}, st.recipients[0].key, "Recipient key must not be held in Go heap")
+	assert.Equal(t, [32]byte{2}, *st.recipients[0].buf.key, "Recipient key must be held in keyBuffer")
+	scoped, err := st.Scoped("app")
+	assert.Nil(t, err, "Err in Scoped must be nil")
+	assert.Nil(t, scoped.Put("app/a", TestType{C: "a"}, nil), "Err in Put must be nil")
+	scoped.Close()
+	assert.Equal(t, private, *st.private, "Close of scoped Store must keep private key of parent")
+	assert.Equal(t, [32]byte{2}, *st.recipients[0].buf.key,
+		"Close of scoped Store must keep recipient keys of parent")
+
+	st.Close()
+	assert.Equal(t, [32]byte{}, *st.private, "Close must zero private key")
+	assert.Equal(t, [32]byte{}, *st.recipients[0].buf.key, "Close must zero recipient keys")
+}
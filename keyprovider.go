@@ -0,0 +1,282 @@
+package svalkey
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrKeyFormat represents key which is not 32 bytes,
+	// hex or base64 encoded error
+	ErrKeyFormat = fmt.Errorf("svalkey: in ParseKey" +
+		" key must be 32 bytes, hex or base64 encoded")
+	// ErrNoKey represents missing key error
+	ErrNoKey = fmt.Errorf("svalkey: in KeyProvider" +
+		" key is not set")
+	// ErrKeyringUnsupported represents unsupported OS keyring error
+	ErrKeyringUnsupported = fmt.Errorf("svalkey: in KeyringKeyProvider" +
+		" OS keyring is not supported")
+)
+
+const (
+	// DefaultExecTimeout is the timeout of ExecKeyProvider command
+	// if ExecKeyProvider.Timeout is not set
+	DefaultExecTimeout = 10 * time.Second
+	// DefaultRefreshGrace is the time KeyRefresher keeps replaced
+	// Store open if SetGrace is not called
+	DefaultRefreshGrace = time.Minute
+)
+
+// KeyProvider supplies the master key of Store
+type KeyProvider interface {
+	// Key returns the current master key
+	Key() ([32]byte, error)
+}
+
+// ParseKey decodes hex or base64 encoded 32 byte key.
+// Raw keys are accepted only from key files by FileKeyProvider
+func ParseKey(data []byte) (key [32]byte, err error) {
+	text := string(bytes.TrimSpace(data))
+	decoders := []func(string) ([]byte, error){
+		hex.DecodeString,
+		base64.StdEncoding.DecodeString,
+		base64.RawStdEncoding.DecodeString,
+		base64.URLEncoding.DecodeString,
+		base64.RawURLEncoding.DecodeString,
+	}
+	for _, decode := range decoders {
+		if k, err := decode(text); err == nil && len(k) == len(key) {
+			copy(key[:], k)
+			zeroBytes(k)
+			return key, nil
+		}
+	}
+	return key, ErrKeyFormat
+}
+
+// parseKeyFile reads raw 32 byte key or decodes it with ParseKey
+func parseKeyFile(data []byte) (key [32]byte, err error) {
+	if len(data) == len(key) {
+		copy(key[:], data)
+		return key, nil
+	}
+	return ParseKey(data)
+}
+
+// EnvKeyProvider reads hex or base64 encoded key
+// from environment variable Name
+type EnvKeyProvider struct {
+	Name string
+}
+
+// Key returns the key
+func (p *EnvKeyProvider) Key() ([32]byte, error) {
+	v := os.Getenv(p.Name)
+	if v == "" {
+		return [32]byte{}, fmt.Errorf("%s; environment variable %s is empty", ErrNoKey, p.Name)
+	}
+	return ParseKey([]byte(v))
+}
+
+// FileKeyProvider reads raw, hex or base64 encoded key from file Path
+type FileKeyProvider struct {
+	Path string
+}
+
+// Key returns the key
+func (p *FileKeyProvider) Key() ([32]byte, error) {
+	data, err := ioutil.ReadFile(p.Path)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	defer zeroBytes(data)
+	return parseKeyFile(data)
+}
+
+// PassphraseKeyProvider reads key file Path encrypted
+// with passphrase by WritePassphraseKeyFile
+type PassphraseKeyProvider struct {
+	Path string
+	// Passphrase returns the passphrase, it is called
+	// on every Key call
+	Passphrase func() ([]byte, error)
+}
+
+// Key returns the key
+func (p *PassphraseKeyProvider) Key() (key [32]byte, err error) {
+	f, err := os.Open(p.Path)
+	if err != nil {
+		return key, err
+	}
+	defer f.Close()
+	passphrase, err := p.Passphrase()
+	if err != nil {
+		return key, err
+	}
+	defer zeroBytes(passphrase)
+	data, err := DecryptData(passphrase, f)
+	defer zeroBytes(data)
+	if err != nil {
+		return key, err
+	}
+	if len(data) != len(key) {
+		return key, ErrKeyFormat
+	}
+	copy(key[:], data)
+	return key, nil
+}
+
+// WritePassphraseKeyFile writes key encrypted with EncryptData
+// under passphrase to file path, readable only by its owner
+func WritePassphraseKeyFile(path string, key [32]byte, passphrase []byte) error {
+	data, err := EncryptData(passphrase, key[:])
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// ExecKeyProvider runs Command with Args and reads
+// hex or base64 encoded key from its stdout
+type ExecKeyProvider struct {
+	Command string
+	Args    []string
+	// Timeout kills the command, default is DefaultExecTimeout
+	Timeout time.Duration
+}
+
+// Key returns the key
+func (p *ExecKeyProvider) Key() ([32]byte, error) {
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = DefaultExecTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	stderr := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, p.Command, p.Args...)
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	defer zeroBytes(out)
+	if err != nil {
+		return [32]byte{}, fmt.Errorf("svalkey: error run key command %s; %s: %s",
+			p.Command, err.Error(), bytes.TrimSpace(stderr.Bytes()))
+	}
+	return ParseKey(out)
+}
+
+// KeyringKeyProvider is a placeholder for OS keyring (Secret Service,
+// macOS Keychain, Windows Credential Manager) provider. Key always
+// returns ErrKeyringUnsupported, use ExecKeyProvider with
+// the platform keyring tool meanwhile
+type KeyringKeyProvider struct {
+	Service string
+	User    string
+}
+
+// Key returns ErrKeyringUnsupported
+func (p *KeyringKeyProvider) Key() ([32]byte, error) {
+	return [32]byte{}, ErrKeyringUnsupported
+}
+
+// KeyRefresher holds Store opened with the key of KeyProvider and
+// reopens it when the key is rotated. Long-running processes get
+// Store with Store before every use. Replaced Store is closed
+// after the grace period, operations running at that time are
+// waited for, later ones fail with ErrStoreClosed.
+// It is safe for concurrent use
+type KeyRefresher struct {
+	provider KeyProvider
+	open     func(key [32]byte) (*Store, error)
+	// refresh serializes Refresh calls
+	refresh sync.Mutex
+	mu      sync.RWMutex
+	store   *Store
+	check   []byte
+	grace   time.Duration
+}
+
+// NewKeyRefresher gets the key from p and opens Store with open
+func NewKeyRefresher(p KeyProvider,
+	open func(key [32]byte) (*Store, error)) (*KeyRefresher, error) {
+	r := &KeyRefresher{provider: p, open: open, grace: DefaultRefreshGrace}
+	if _, err := r.Refresh(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Store returns Store opened with the current key
+func (r *KeyRefresher) Store() *Store {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.store
+}
+
+// SetGrace sets the time replaced Store is kept open
+// for callers which got it before Refresh
+func (r *KeyRefresher) SetGrace(d time.Duration) {
+	r.mu.Lock()
+	r.grace = d
+	r.mu.Unlock()
+}
+
+// Refresh gets the key from provider and reopens Store
+// if the key is changed. It reports whether Store is reopened.
+// Store is kept if the provider or open fails, the replaced
+// Store is closed after the grace period
+func (r *KeyRefresher) Refresh() (bool, error) {
+	r.refresh.Lock()
+	defer r.refresh.Unlock()
+	key, err := r.provider.Key()
+	defer zeroBytes(key[:])
+	if err != nil {
+		return false, err
+	}
+	check := keyCheck(key)
+	r.mu.RLock()
+	same := r.store != nil && hmac.Equal(check, r.check)
+	r.mu.RUnlock()
+	if same {
+		return false, nil
+	}
+	st, err := r.open(key)
+	if err != nil {
+		return false, err
+	}
+	r.mu.Lock()
+	old, grace := r.store, r.grace
+	r.store, r.check = st, check
+	r.mu.Unlock()
+	if old != nil {
+		time.AfterFunc(grace, old.Close)
+	}
+	return true, nil
+}
+
+// Run refreshes Store every interval until stop is closed.
+// Errors of Refresh are passed to onError if it is not nil
+func (r *KeyRefresher) Run(interval time.Duration, stop <-chan struct{},
+	onError func(err error)) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			if _, err := r.Refresh(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
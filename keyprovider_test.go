@@ -0,0 +1,132 @@
+package svalkey
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKey(t *testing.T) {
+	raw := bytes.Repeat([]byte{0xa5}, 32)
+	var want [32]byte
+	copy(want[:], raw)
+
+	for _, data := range [][]byte{
+		[]byte(hex.EncodeToString(raw) + "\n"),
+		[]byte(base64.StdEncoding.EncodeToString(raw)),
+		[]byte(base64.RawURLEncoding.EncodeToString(raw)),
+	} {
+		key, err := ParseKey(data)
+		assert.Nil(t, err, "Err in ParseKey must be nil")
+		assert.Equal(t, want, key)
+	}
+
+	_, err := ParseKey(raw)
+	assert.Equal(t, ErrKeyFormat, err, "Err in ParseKey of raw key must not be nil")
+	_, err = ParseKey([]byte("short key"))
+	assert.Equal(t, ErrKeyFormat, err, "Err in ParseKey of short key must not be nil")
+	_, err = ParseKey([]byte(hex.EncodeToString(raw[:20])))
+	assert.Equal(t, ErrKeyFormat, err, "Err in ParseKey of 20 byte key must not be nil")
+}
+
+func TestKeyProviders(t *testing.T) {
+	dir, err := ioutil.TempDir("", "svalkey")
+	assert.Nil(t, err, "Err in TempDir must be nil")
+	defer os.RemoveAll(dir)
+	encoded := hex.EncodeToString(testSecret[:])
+
+	os.Setenv("SVALKEY_TEST_KEY", encoded)
+	defer os.Unsetenv("SVALKEY_TEST_KEY")
+	keyFile := filepath.Join(dir, "key")
+	assert.Nil(t, ioutil.WriteFile(keyFile, []byte(encoded+"\n"), 0600), "Err in WriteFile must be nil")
+	rawFile := filepath.Join(dir, "key.bin")
+	assert.Nil(t, ioutil.WriteFile(rawFile, testSecret[:], 0600), "Err in WriteFile must be nil")
+	sealedFile := filepath.Join(dir, "key.enc")
+	assert.Nil(t, WritePassphraseKeyFile(sealedFile, testSecret, []byte("passphrase")),
+		"Err in WritePassphraseKeyFile must be nil")
+	passphrase := func(p string) func() ([]byte, error) {
+		return func() ([]byte, error) { return []byte(p), nil }
+	}
+
+	for name, p := range map[string]KeyProvider{
+		"env":        &EnvKeyProvider{Name: "SVALKEY_TEST_KEY"},
+		"file":       &FileKeyProvider{Path: keyFile},
+		"raw file":   &FileKeyProvider{Path: rawFile},
+		"passphrase": &PassphraseKeyProvider{Path: sealedFile, Passphrase: passphrase("passphrase")},
+		"exec":       &ExecKeyProvider{Command: "cat", Args: []string{keyFile}},
+	} {
+		key, err := p.Key()
+		assert.Nil(t, err, "Err in %s Key must be nil", name)
+		assert.Equal(t, testSecret, key, "%s Key must return the key", name)
+	}
+
+	for name, p := range map[string]KeyProvider{
+		"env":        &EnvKeyProvider{Name: "SVALKEY_TEST_MISSING"},
+		"file":       &FileKeyProvider{Path: filepath.Join(dir, "missing")},
+		"passphrase": &PassphraseKeyProvider{Path: sealedFile, Passphrase: passphrase("wrong")},
+		"exec":       &ExecKeyProvider{Command: "false"},
+		"raw exec":   &ExecKeyProvider{Command: "cat", Args: []string{rawFile}},
+		"keyring":    &KeyringKeyProvider{Service: "svalkey"},
+	} {
+		_, err := p.Key()
+		assert.NotNil(t, err, "Err in %s Key must not be nil", name)
+	}
+}
+
+func TestKeyRefresher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "svalkey")
+	assert.Nil(t, err, "Err in TempDir must be nil")
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "key")
+	assert.Nil(t, ioutil.WriteFile(keyFile, testSecret[:], 0600), "Err in WriteFile must be nil")
+
+	opened := 0
+	r, err := NewKeyRefresher(&FileKeyProvider{Path: keyFile}, func(key [32]byte) (*Store, error) {
+		opened++
+		return NewCustomStore(NewMock(), JSONCodec{}, []byte{1, 0}, key)
+	})
+	assert.Nil(t, err, "Err in NewKeyRefresher must be nil")
+	first := r.Store()
+	assert.Equal(t, testSecret, *first.key, "Store must be opened with provided key")
+	changed, err := r.Refresh()
+	assert.Nil(t, err, "Err in Refresh must be nil")
+	assert.False(t, changed, "Store must not be reopened with the same key")
+	assert.Equal(t, 1, opened, "Store must be opened once")
+	r.SetGrace(0)
+
+	rotated := [32]byte{9}
+	assert.Nil(t, ioutil.WriteFile(keyFile, rotated[:], 0600), "Err in WriteFile must be nil")
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		r.Run(time.Millisecond, stop, nil)
+		close(done)
+	}()
+	for i := 0; i < 1000 && r.Store() == first; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	close(stop)
+	<-done
+	assert.Equal(t, rotated, *r.Store().key, "Store must be reopened with rotated key")
+	closed := false
+	for i := 0; i < 1000 && !closed; i++ {
+		var v string
+		err = first.Get("key", &v, nil)
+		closed = err == ErrStoreClosed
+		time.Sleep(time.Millisecond)
+	}
+	assert.True(t, closed, "Replaced Store must be closed after grace period")
+
+	os.Remove(keyFile)
+	changed, err = r.Refresh()
+	assert.NotNil(t, err, "Err in Refresh of missing key must not be nil")
+	assert.False(t, changed, "Store must be kept if provider fails")
+	assert.Equal(t, rotated, *r.Store().key, "Store must be kept if provider fails")
+}
@@ -0,0 +1,18 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly && !solaris
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly,!solaris
+
+package svalkey
+
+func allocLocked(size int) ([]byte, error) {
+	return nil, ErrMemLock
+}
+
+func freeLocked(b []byte) {
+	zeroBytes(b)
+}
+
+func allocGuarded(size int) ([]byte, []byte, error) {
+	return nil, nil, ErrMemLock
+}
+
+func freeGuarded(region []byte) {}
@@ -0,0 +1,73 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly || solaris
+// +build linux darwin freebsd netbsd openbsd dragonfly solaris
+
+package svalkey
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// allocLocked allocates size bytes outside of Go heap and locks
+// them in RAM, so they are never written to swap
+func allocLocked(size int) ([]byte, error) {
+	if size == 0 {
+		return []byte{}, nil
+	}
+	b, err := unix.Mmap(-1, 0, size, unix.PROT_READ|unix.PROT_WRITE,
+		unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.Mlock(b); err != nil {
+		unix.Munmap(b)
+		return nil, err
+	}
+	return b, nil
+}
+
+// freeLocked zeroes and releases memory allocated with allocLocked
+func freeLocked(b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	zeroBytes(b)
+	unix.Munlock(b)
+	unix.Munmap(b)
+}
+
+// allocGuarded allocates size bytes locked in RAM between two
+// inaccessible guard pages. The returned slice ends at the end
+// of its page, so overflow past it faults. region is the whole
+// mapping to release with freeGuarded
+func allocGuarded(size int) (b, region []byte, err error) {
+	page := unix.Getpagesize()
+	data := (size + page - 1) / page * page
+	region, err = unix.Mmap(-1, 0, data+2*page, unix.PROT_READ|unix.PROT_WRITE,
+		unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = unix.Mprotect(region[:page], unix.PROT_NONE); err == nil {
+		err = unix.Mprotect(region[page+data:], unix.PROT_NONE)
+	}
+	if err == nil {
+		err = unix.Mlock(region[page : page+data])
+	}
+	if err != nil {
+		unix.Munmap(region)
+		return nil, nil, err
+	}
+	return region[page+data-size : page+data], region, nil
+}
+
+// freeGuarded zeroes and releases memory allocated with allocGuarded
+func freeGuarded(region []byte) {
+	page := unix.Getpagesize()
+	if len(region) < 2*page {
+		return
+	}
+	data := region[page : len(region)-page]
+	zeroBytes(data)
+	unix.Munlock(data)
+	unix.Munmap(region)
+}
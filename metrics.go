@@ -0,0 +1,61 @@
+package svalkey
+
+import (
+	"time"
+)
+
+// Metrics receives Store instrumentation events.
+// Implementations must be safe for concurrent use.
+// See metrics/prometheus for Prometheus adapter
+type Metrics interface {
+	// ObserveOperation is called when Store operation op
+	// (put, get, list, ...) is finished
+	ObserveOperation(op string, d time.Duration, err error)
+	// ObserveBackend is called when backend call op is finished
+	ObserveBackend(op string, d time.Duration, err error)
+	// ObserveCodec is called when a value is encoded and encrypted
+	// (op "encode") or decrypted and decoded (op "decode")
+	ObserveCodec(op string, d time.Duration, err error)
+	// ObserveValueSize is called with size of encrypted value
+	// written to (dir "write") or read from (dir "read") backend
+	ObserveValueSize(dir string, n int)
+	// IncAuthFailures is called when a value fails authentication
+	IncAuthFailures()
+	// ObserveCache is called on CachedStore lookup
+	ObserveCache(hit bool)
+}
+
+// NopMetrics discards all events
+type NopMetrics struct{}
+
+// ObserveOperation does nothing
+func (NopMetrics) ObserveOperation(string, time.Duration, error) {}
+
+// ObserveBackend does nothing
+func (NopMetrics) ObserveBackend(string, time.Duration, error) {}
+
+// ObserveCodec does nothing
+func (NopMetrics) ObserveCodec(string, time.Duration, error) {}
+
+// ObserveValueSize does nothing
+func (NopMetrics) ObserveValueSize(string, int) {}
+
+// IncAuthFailures does nothing
+func (NopMetrics) IncAuthFailures() {}
+
+// ObserveCache does nothing
+func (NopMetrics) ObserveCache(bool) {}
+
+// SetMetrics sets instrumentation of Store operations.
+// Nil m disables it
+func (s *Store) SetMetrics(m Metrics) {
+	if m == nil {
+		m = NopMetrics{}
+	}
+	s.metrics = m
+}
+
+// observeBackend reports backend call op started at start
+func (s *Store) observeBackend(op string, start time.Time, err error) {
+	s.metrics.ObserveBackend(op, time.Since(start), err)
+}
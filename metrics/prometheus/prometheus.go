@@ -0,0 +1,126 @@
+// Package prometheus exports svalkey Store metrics to Prometheus.
+//
+//	c := prometheus.NewCollector("myapp")
+//	client.MustRegister(c)
+//	st.SetMetrics(c)
+package prometheus
+
+import (
+	"time"
+
+	"github.com/karantin2020/svalkey"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector implements svalkey.Metrics and prometheus.Collector
+type Collector struct {
+	operations   *prom.HistogramVec
+	backend      *prom.HistogramVec
+	codec        *prom.HistogramVec
+	valueSize    *prom.HistogramVec
+	authFailures prom.Counter
+	cache        *prom.CounterVec
+}
+
+var _ svalkey.Metrics = (*Collector)(nil)
+
+// NewCollector creates Collector with metrics
+// prefixed with namespace and "svalkey" subsystem
+func NewCollector(namespace string) *Collector {
+	opts := func(name, help string) prom.HistogramOpts {
+		return prom.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "svalkey",
+			Name:      name,
+			Help:      help,
+			Buckets:   prom.DefBuckets,
+		}
+	}
+	sizeOpts := opts("value_size_bytes", "Size of encrypted values written to and read from backend.")
+	sizeOpts.Buckets = prom.ExponentialBuckets(64, 4, 10)
+	return &Collector{
+		operations: prom.NewHistogramVec(
+			opts("operation_duration_seconds", "Duration of Store operations."),
+			[]string{"op", "status"}),
+		backend: prom.NewHistogramVec(
+			opts("backend_duration_seconds", "Duration of backend calls."),
+			[]string{"op", "status"}),
+		codec: prom.NewHistogramVec(
+			opts("codec_duration_seconds", "Duration of value encoding and decoding with encryption."),
+			[]string{"op", "status"}),
+		valueSize: prom.NewHistogramVec(sizeOpts, []string{"dir"}),
+		authFailures: prom.NewCounter(prom.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "svalkey",
+			Name:      "auth_failures_total",
+			Help:      "Number of values failed authentication.",
+		}),
+		cache: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "svalkey",
+			Name:      "cache_lookups_total",
+			Help:      "Number of CachedStore lookups.",
+		}, []string{"result"}),
+	}
+}
+
+func status(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// ObserveOperation observes Store operation duration
+func (c *Collector) ObserveOperation(op string, d time.Duration, err error) {
+	c.operations.WithLabelValues(op, status(err)).Observe(d.Seconds())
+}
+
+// ObserveBackend observes backend call duration
+func (c *Collector) ObserveBackend(op string, d time.Duration, err error) {
+	c.backend.WithLabelValues(op, status(err)).Observe(d.Seconds())
+}
+
+// ObserveCodec observes encode and decode duration
+func (c *Collector) ObserveCodec(op string, d time.Duration, err error) {
+	c.codec.WithLabelValues(op, status(err)).Observe(d.Seconds())
+}
+
+// ObserveValueSize observes size of encrypted value
+func (c *Collector) ObserveValueSize(dir string, n int) {
+	c.valueSize.WithLabelValues(dir).Observe(float64(n))
+}
+
+// IncAuthFailures counts authentication failure
+func (c *Collector) IncAuthFailures() {
+	c.authFailures.Inc()
+}
+
+// ObserveCache counts cache lookup
+func (c *Collector) ObserveCache(hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	c.cache.WithLabelValues(result).Inc()
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prom.Desc) {
+	c.operations.Describe(ch)
+	c.backend.Describe(ch)
+	c.codec.Describe(ch)
+	c.valueSize.Describe(ch)
+	c.authFailures.Describe(ch)
+	c.cache.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prom.Metric) {
+	c.operations.Collect(ch)
+	c.backend.Collect(ch)
+	c.codec.Collect(ch)
+	c.valueSize.Collect(ch)
+	c.authFailures.Collect(ch)
+	c.cache.Collect(ch)
+}
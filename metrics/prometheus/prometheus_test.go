@@ -0,0 +1,48 @@
+package prometheus
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollector(t *testing.T) {
+	c := NewCollector("test")
+	reg := prom.NewPedanticRegistry()
+	assert.Nil(t, reg.Register(c), "Err in Register must be nil")
+
+	c.ObserveOperation("get", time.Millisecond, nil)
+	c.ObserveOperation("get", time.Millisecond, errors.New("fail"))
+	c.ObserveBackend("get", time.Millisecond, nil)
+	c.ObserveCodec("decode", time.Millisecond, nil)
+	c.ObserveValueSize("read", 100)
+	c.IncAuthFailures()
+	c.ObserveCache(true)
+	c.ObserveCache(true)
+	c.ObserveCache(false)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(c.authFailures))
+	assert.Equal(t, 2.0, testutil.ToFloat64(c.cache.WithLabelValues("hit")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(c.cache.WithLabelValues("miss")))
+
+	families, err := reg.Gather()
+	assert.Nil(t, err, "Err in Gather must be nil")
+	names := map[string]bool{}
+	for _, f := range families {
+		names[f.GetName()] = true
+	}
+	for _, n := range []string{
+		"test_svalkey_operation_duration_seconds",
+		"test_svalkey_backend_duration_seconds",
+		"test_svalkey_codec_duration_seconds",
+		"test_svalkey_value_size_bytes",
+		"test_svalkey_auth_failures_total",
+		"test_svalkey_cache_lookups_total",
+	} {
+		assert.True(t, names[n], "Metric must be gathered: "+n)
+	}
+}
@@ -0,0 +1,119 @@
+package svalkey
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordMetrics counts instrumentation events
+type recordMetrics struct {
+	sync.Mutex
+	ops     map[string]int
+	errs    map[string]int
+	backend map[string]int
+	codec   map[string]int
+	bytes   map[string]int
+	auth    int
+	hits    int
+	misses  int
+}
+
+func newRecordMetrics() *recordMetrics {
+	return &recordMetrics{
+		ops:     map[string]int{},
+		errs:    map[string]int{},
+		backend: map[string]int{},
+		codec:   map[string]int{},
+		bytes:   map[string]int{},
+	}
+}
+
+func (m *recordMetrics) ObserveOperation(op string, d time.Duration, err error) {
+	m.Lock()
+	defer m.Unlock()
+	m.ops[op]++
+	if err != nil {
+		m.errs[op]++
+	}
+}
+
+func (m *recordMetrics) ObserveBackend(op string, d time.Duration, err error) {
+	m.Lock()
+	defer m.Unlock()
+	m.backend[op]++
+}
+
+func (m *recordMetrics) ObserveCodec(op string, d time.Duration, err error) {
+	m.Lock()
+	defer m.Unlock()
+	m.codec[op]++
+}
+
+func (m *recordMetrics) ObserveValueSize(dir string, n int) {
+	m.Lock()
+	defer m.Unlock()
+	m.bytes[dir] += n
+}
+
+func (m *recordMetrics) IncAuthFailures() {
+	m.Lock()
+	defer m.Unlock()
+	m.auth++
+}
+
+func (m *recordMetrics) ObserveCache(hit bool) {
+	m.Lock()
+	defer m.Unlock()
+	if hit {
+		m.hits++
+	} else {
+		m.misses++
+	}
+}
+
+func TestStore_Metrics(t *testing.T) {
+	mock := NewMock()
+	st, err := NewCustomStore(mock, JSONCodec{}, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	m := newRecordMetrics()
+	st.SetMetrics(m)
+
+	assert.Nil(t, st.Put("a", TestType{C: "a"}, nil), "Err in Put must be nil")
+	out := TestType{}
+	assert.Nil(t, st.Get("a", &out, nil), "Err in Get must be nil")
+	assert.NotNil(t, st.Get("missing", &out, nil), "Err in Get must not be nil")
+	assert.Equal(t, 1, m.ops["put"])
+	assert.Equal(t, 2, m.ops["get"])
+	assert.Equal(t, 1, m.errs["get"])
+	assert.Equal(t, 1, m.backend["put"])
+	assert.Equal(t, 2, m.backend["get"])
+	assert.Equal(t, 1, m.codec["encode"])
+	assert.Equal(t, 1, m.codec["decode"])
+	assert.Equal(t, len(mock.kv["a"]), m.bytes["write"])
+	assert.Equal(t, len(mock.kv["a"]), m.bytes["read"])
+
+	mock.kv["a"][len(mock.kv["a"])-1] ^= 0xff
+	assert.NotNil(t, st.Get("a", &out, nil), "Err in Get of tampered value must not be nil")
+	assert.Equal(t, 1, m.auth, "Authentication failure must be counted")
+
+	c, err := NewCachedStore(st, nil)
+	assert.Nil(t, err, "Err in NewCachedStore must be nil")
+	assert.Nil(t, c.PutBytes("b", []byte("b"), nil), "Err in PutBytes must be nil")
+	for i := 0; i < 3; i++ {
+		_, err = c.GetBytes("b", nil)
+		assert.Nil(t, err, "Err in GetBytes must be nil")
+	}
+	assert.Equal(t, 1, m.misses)
+	assert.Equal(t, 2, m.hits)
+
+	assert.Nil(t, st.PutStream("s", strings.NewReader("stream"), nil), "Err in PutStream must be nil")
+	m.bytes["read"] = 0
+	r, err := st.GetStream("s", nil)
+	assert.Nil(t, err, "Err in GetStream must be nil")
+	r.Close()
+	assert.Equal(t, len(mock.kv["s"]), m.bytes["read"], "GetStream must observe value size")
+}
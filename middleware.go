@@ -0,0 +1,160 @@
+package svalkey
+
+import (
+	"context"
+	"io"
+
+	"github.com/abronan/valkeyrie/store"
+)
+
+// Operation names passed to interceptors
+const (
+	OpPut        = "put"
+	OpGet        = "get"
+	OpGetBytes   = "get_bytes"
+	OpPutStream  = "put_stream"
+	OpGetStream  = "get_stream"
+	OpDelete     = "delete"
+	OpExists     = "exists"
+	OpList       = "list"
+	OpDeleteTree = "delete_tree"
+	OpGetMany    = "get_many"
+	OpPutMany    = "put_many"
+	OpDeleteMany = "delete_many"
+	OpWatch      = "watch"
+	OpRewrap     = "rewrap"
+	OpExport     = "export"
+	OpImport     = "import"
+	OpVerify     = "verify"
+	OpMigrate    = "migrate"
+)
+
+// SecureStore is the set of Store operations. It is implemented
+// by Store and CachedStore
+type SecureStore interface {
+	Put(key string, value interface{}, options *store.WriteOptions) error
+	Get(key string, value interface{}, options *store.ReadOptions) error
+	PutBytes(key string, value []byte, options *store.WriteOptions) error
+	GetBytes(key string, options *store.ReadOptions) ([]byte, error)
+	PutStream(key string, r io.Reader, options *store.WriteOptions) error
+	GetStream(key string, options *store.ReadOptions) (io.ReadCloser, error)
+	Delete(key string) error
+	Exists(key string, options *store.ReadOptions) (bool, error)
+	List(directory string, value interface{},
+		options *store.ReadOptions) ([]*ListPair, error)
+	DeleteTree(directory string) error
+	GetMany(keys []string, out interface{}, opts *BatchOptions) error
+	PutMany(values map[string]interface{}, opts *BatchOptions) error
+	DeleteMany(keys []string, opts *BatchOptions) error
+	Close()
+}
+
+var (
+	_ SecureStore = (*Store)(nil)
+	_ SecureStore = (*CachedStore)(nil)
+)
+
+// Operation describes Store operation passed through interceptors.
+// Fields not used by the operation are zero
+type Operation struct {
+	// Context carries the operation span and identity
+	Context context.Context
+	// Name is one of Op* constants
+	Name string
+	// Key is the key of single key operations
+	// or the directory of List and DeleteTree
+	Key string
+	// Keys are the keys of batch operations and the value keys
+	// of Export, Import, Verify and Migrate
+	Keys []string
+	// Value is the value to put, the pointer to decode into,
+	// the out slice of List and GetMany or the values of PutMany
+	Value        interface{}
+	Reader       io.Reader
+	ReadOptions  *store.ReadOptions
+	WriteOptions *store.WriteOptions
+	BatchOptions *BatchOptions
+	// Result is set by the handler: []byte for GetBytes,
+	// io.ReadCloser for GetStream, bool for Exists
+	// and []*ListPair for List
+	Result interface{}
+}
+
+// Handler performs operation op
+type Handler func(op *Operation) error
+
+// Interceptor wraps handler of Store operations. It may inspect
+// or change op, short-circuit it returning error
+// or call next to proceed
+type Interceptor func(next Handler) Handler
+
+// Use appends interceptors to the chain of Store operations.
+// The first interceptor is the outermost one.
+// Tracing, metrics and audit wrap the whole chain,
+// so operations rejected by interceptors are recorded too
+func (s *Store) Use(interceptors ...Interceptor) {
+	chain := make([]Interceptor, 0, len(s.interceptors)+len(interceptors))
+	chain = append(chain, s.interceptors...)
+	s.interceptors = append(chain, interceptors...)
+}
+
+// run passes op through interceptors to h
+func (s *Store) run(op *Operation, h Handler) (err error) {
+	keys := op.Keys
+	if keys == nil {
+		keys = []string{op.Key}
+	}
+	ctx, end := s.startOperation(op.Name, keys...)
+	if err = s.keyBuf.acquire(); err != nil {
+		end(err)
+		return err
+	}
+	defer func() {
+		end(err)
+		s.keyBuf.release()
+	}()
+	op.Context = ctx
+	for _, key := range keys {
+		if !s.inScope(key) {
+			return ErrOutOfScope
+		}
+	}
+	if s.writeOnly() && readsValues(op.Name) {
+		return ErrWriteOnly
+	}
+	if writesValues(op.Name) {
+		for _, key := range keys {
+			if isChunkKey(key) || isReservedKey(key) {
+				return ErrInvalidPath
+			}
+		}
+	}
+	for i := len(s.interceptors) - 1; i >= 0; i-- {
+		h = s.interceptors[i](h)
+	}
+	if s.policy != nil {
+		h = s.policy.Interceptor()(h)
+	}
+	return h(op)
+}
+
+// writesValues reports if operation op puts values. Their keys
+// must not have _chunks segment, which holds chunks of values,
+// or _svalkey segment, which holds internal entries
+func writesValues(op string) bool {
+	switch op {
+	case OpPut, OpPutStream, OpPutMany:
+		return true
+	}
+	return false
+}
+
+// readsValues reports if operation op returns values
+func readsValues(op string) bool {
+	switch op {
+	case OpGet, OpGetBytes, OpGetStream, OpGetMany, OpList,
+		OpExport, OpVerify, OpMigrate:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package svalkey
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordAudit struct {
+	records []*AuditRecord
+}
+
+func (a *recordAudit) Audit(r *AuditRecord) error {
+	a.records = append(a.records, r)
+	return nil
+}
+
+func TestStore_Use(t *testing.T) {
+	st, err := NewCustomStore(NewMock(), JSONCodec{}, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	rec := &recordAudit{}
+	st.SetAuditSink(rec, nil)
+
+	calls := []string{}
+	trace := func(name string) Interceptor {
+		return func(next Handler) Handler {
+			return func(op *Operation) error {
+				calls = append(calls, name+">"+op.Name)
+				err := next(op)
+				calls = append(calls, name+"<"+op.Name)
+				return err
+			}
+		}
+	}
+	errDenied := fmt.Errorf("denied")
+	deny := func(next Handler) Handler {
+		return func(op *Operation) error {
+			if strings.HasPrefix(op.Key, "private/") {
+				return errDenied
+			}
+			return next(op)
+		}
+	}
+	st.Use(trace("outer"), trace("inner"))
+	st.Use(deny)
+
+	assert.Nil(t, st.Put("a", TestType{C: "a"}, nil), "Err in Put must be nil")
+	assert.Equal(t, []string{"outer>put", "inner>put", "inner<put", "outer<put"},
+		calls, "Interceptors must be called in order")
+
+	out := TestType{}
+	assert.Nil(t, st.Get("a", &out, nil), "Err in Get must be nil")
+	assert.Equal(t, "a", out.C, "Get must pass through interceptors")
+	ok, err := st.Exists("a", nil)
+	assert.Nil(t, err, "Err in Exists must be nil")
+	assert.True(t, ok, "Exists result must pass through interceptors")
+
+	assert.Equal(t, errDenied, st.Put("private/a", TestType{C: "a"}, nil),
+		"Put must be denied")
+	ok, err = st.Exists("private/a", nil)
+	assert.Equal(t, errDenied, err, "Exists must be denied")
+	assert.False(t, ok, "Denied Exists must return false")
+	last := rec.records[len(rec.records)-1]
+	assert.Equal(t, AuditFailure, last.Outcome, "Denied operation must be audited")
+
+	calls = nil
+	assert.Nil(t, st.PutMany(map[string]interface{}{"b": TestType{}}, nil),
+		"Err in PutMany must be nil")
+	assert.Equal(t, []string{"outer>put_many", "inner>put_many",
+		"inner<put_many", "outer<put_many"}, calls, "Batch operations must be intercepted")
+}
+
+func TestCachedStore_Use(t *testing.T) {
+	st, err := NewCustomStore(NewMock(), JSONCodec{}, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	gets := 0
+	st.Use(func(next Handler) Handler {
+		return func(op *Operation) error {
+			if op.Name == OpGet {
+				gets++
+			}
+			return next(op)
+		}
+	})
+	cst, err := NewCachedStore(st, nil)
+	assert.Nil(t, err, "Err in NewCachedStore must be nil")
+	var ss SecureStore = cst
+	defer ss.Close()
+	assert.Nil(t, ss.Put("a", TestType{C: "a"}, nil), "Err in Put must be nil")
+	for i := 0; i < 2; i++ {
+		out := TestType{}
+		assert.Nil(t, ss.Get("a", &out, nil), "Err in Get must be nil")
+		assert.Equal(t, "a", out.C, "Get must return put value")
+	}
+	assert.Equal(t, 2, gets, "Cached reads must be intercepted")
+}
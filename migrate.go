@@ -0,0 +1,342 @@
+package svalkey
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/abronan/valkeyrie/store"
+)
+
+// MigrateOptions holds Migrate settings
+type MigrateOptions struct {
+	// Reencrypt decrypts values with the src key and encrypts them
+	// with the dst key. Otherwise values are copied in the backend
+	// format, so dst must use the same key as src
+	Reencrypt bool
+	// NewValue returns a pointer to a value of key's type. If it is
+	// set values are decoded with the src codec and encoded with the
+	// dst codec, so Migrate can change codec. It implies Reencrypt
+	NewValue func(key string) interface{}
+	// Workers is the number of values copied concurrently, default 1
+	Workers int
+	// Checkpoint records copied keys. Keys marked as done are
+	// skipped, so interrupted Migrate can be resumed
+	Checkpoint Checkpoint
+}
+
+// MigrateReport holds Migrate result
+type MigrateReport struct {
+	// Copied keys
+	Copied []string `json:"copied"`
+	// Skipped keys which were marked as done in Checkpoint
+	Skipped []string `json:"skipped"`
+	// Failed keys with errors of copy or verification
+	Failed map[string]string `json:"failed"`
+	// Missing keys are in src but not in dst after Migrate
+	Missing []string `json:"missing"`
+	// Extra keys are in dst but not in src
+	Extra []string `json:"extra"`
+}
+
+// Checkpoint records progress of Migrate
+type Checkpoint interface {
+	// Done reports whether key was copied
+	Done(key string) bool
+	// Mark records key as copied
+	Mark(key string) error
+}
+
+// FileCheckpoint appends copied keys to a file, one key per line
+type FileCheckpoint struct {
+	sync.Mutex
+	f    *os.File
+	done map[string]bool
+}
+
+// NewFileCheckpoint returns Checkpoint which records copied keys
+// in the file at path. Keys recorded earlier are loaded from it
+func NewFileCheckpoint(path string) (*FileCheckpoint, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	c := &FileCheckpoint{f: f, done: map[string]bool{}}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		c.done[sc.Text()] = true
+	}
+	if err := sc.Err(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Done reports whether key was copied
+func (c *FileCheckpoint) Done(key string) bool {
+	c.Lock()
+	defer c.Unlock()
+	return c.done[key]
+}
+
+// Mark records key as copied
+func (c *FileCheckpoint) Mark(key string) error {
+	c.Lock()
+	defer c.Unlock()
+	if _, err := fmt.Fprintln(c.f, key); err != nil {
+		return err
+	}
+	c.done[key] = true
+	return c.f.Sync()
+}
+
+// Close closes checkpoint file
+func (c *FileCheckpoint) Close() error {
+	return c.f.Close()
+}
+
+// Migrate copies all values under prefix from src to dst store.
+// Every copied value is verified: it must decrypt on dst.
+// Primers of primed codecs are copied too. The report lists
+// copied, skipped and failed keys and the difference of key sets
+// under prefix in src and dst after copy.
+//
+// Migrate runs as OpMigrate operation on src and OpImport operation
+// on dst with the keys of values, so Policy requires read capability
+// in src and write capability in dst on every one of them
+func Migrate(src, dst *Store, prefix string, opts *MigrateOptions) (*MigrateReport, error) {
+	if opts == nil {
+		opts = &MigrateOptions{}
+	}
+	prefix, err := src.scope(prefix)
+	if err != nil {
+		return nil, err
+	}
+	if !dst.inScope(prefix) {
+		return nil, ErrOutOfScope
+	}
+	srcKeys, err := listKeys(src, prefix)
+	if err != nil {
+		return nil, err
+	}
+	var rep *MigrateReport
+	err = src.run(&Operation{Name: OpMigrate, Key: prefix, Keys: srcKeys}, func(srcOp *Operation) error {
+		return dst.run(&Operation{Name: OpImport, Key: prefix, Keys: srcKeys}, func(dstOp *Operation) (err error) {
+			rep, err = migrateKeys(src, dst, srcOp.Context, dstOp.Context, prefix, srcKeys, opts)
+			return err
+		})
+	})
+	return rep, err
+}
+
+// migrateKeys copies srcKeys within operations of src and dst
+// running with contexts srcCtx and dstCtx
+func migrateKeys(src, dst *Store, srcCtx, dstCtx context.Context, prefix string,
+	srcKeys []string, opts *MigrateOptions) (*MigrateReport, error) {
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	if err := migratePrimers(src, dst, opts); err != nil {
+		return nil, err
+	}
+	rep := &MigrateReport{
+		Copied:  []string{},
+		Skipped: []string{},
+		Failed:  map[string]string{},
+	}
+	var mu sync.Mutex
+	keys := make(chan string)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range keys {
+				err := migrateValue(src, dst, srcCtx, dstCtx, key, opts)
+				if err == nil && opts.Checkpoint != nil {
+					err = opts.Checkpoint.Mark(key)
+				}
+				mu.Lock()
+				if err != nil {
+					rep.Failed[key] = err.Error()
+				} else {
+					rep.Copied = append(rep.Copied, key)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, key := range srcKeys {
+		if opts.Checkpoint != nil && opts.Checkpoint.Done(key) {
+			rep.Skipped = append(rep.Skipped, key)
+			continue
+		}
+		keys <- key
+	}
+	close(keys)
+	wg.Wait()
+	sort.Strings(rep.Copied)
+
+	dstKeys, err := listKeys(dst, prefix)
+	if err != nil {
+		return rep, err
+	}
+	rep.Missing, rep.Extra = diffKeys(srcKeys, dstKeys)
+	return rep, nil
+}
+
+// listKeys returns sorted keys of values under prefix
+func listKeys(s *Store, prefix string) ([]string, error) {
+	pairs, err := s.list(prefix, nil)
+	if err != nil {
+		if err == store.ErrKeyNotFound {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	pairs = filterInternal(pairs)
+	keys := make([]string, 0, len(pairs))
+	for _, p := range pairs {
+		keys = append(keys, p.Key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// diffKeys returns keys of sorted a missing in sorted b
+// and keys of b missing in a
+func diffKeys(a, b []string) (missing, extra []string) {
+	missing, extra = []string{}, []string{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case j == len(b) || (i < len(a) && a[i] < b[j]):
+			missing = append(missing, a[i])
+			i++
+		case i == len(a) || a[i] > b[j]:
+			extra = append(extra, b[j])
+			j++
+		default:
+			i++
+			j++
+		}
+	}
+	return missing, extra
+}
+
+func migratePrimers(src, dst *Store, opts *MigrateOptions) error {
+	primersDir := src.prefix + primersDir
+	pairs, err := src.list(primersDir, nil)
+	if err != nil {
+		if err == store.ErrKeyNotFound {
+			return nil
+		}
+		return err
+	}
+	for _, p := range pairs {
+		if !strings.HasPrefix(p.Key, primersDir) {
+			continue
+		}
+		if opts.Reencrypt || opts.NewValue != nil {
+			err = reencryptValue(src, dst, p.Key)
+		} else {
+			err = dst.backend("put", false, func() error {
+				return dst.Store.Put(p.Key, p.Value, nil)
+			})
+		}
+		if err != nil {
+			return fmt.Errorf("svalkey: error migrate primer; %s", err.Error())
+		}
+	}
+	return nil
+}
+
+// migrateValue copies value at key. Operations are authorized
+// by Migrate, so values are read and written by handlers
+// without interceptors and policy
+func migrateValue(src, dst *Store, srcCtx, dstCtx context.Context,
+	key string, opts *MigrateOptions) error {
+	switch {
+	case opts.NewValue != nil:
+		val := opts.NewValue(key)
+		err := src.handleGet(&Operation{Context: srcCtx, Name: OpGet, Key: key, Value: val})
+		if err != nil {
+			return err
+		}
+		err = dst.handlePut(&Operation{Context: dstCtx, Name: OpPut, Key: key, Value: val})
+		if err != nil {
+			return err
+		}
+		return dst.handleGet(&Operation{Context: dstCtx, Name: OpGet, Key: key,
+			Value: opts.NewValue(key)})
+	case opts.Reencrypt:
+		if err := reencryptValue(src, dst, key); err != nil {
+			return err
+		}
+	default:
+		data, err := src.get(key, nil)
+		if err != nil {
+			return err
+		}
+		if err := dst.put(key, data, nil); err != nil {
+			return err
+		}
+	}
+	return dst.authenticate(key)
+}
+
+// reencryptValue decrypts value with src key and encrypts
+// it with dst key keeping envelope header fields
+func reencryptValue(src, dst *Store, key string) error {
+	data, err := src.get(key, nil)
+	if err != nil {
+		return err
+	}
+	decrypted, h, err := src.decryptReader(bytes.NewReader(data), src.key[:])
+	if err != nil {
+		return err
+	}
+	buf := pool.Get().(*bytes.Buffer)
+	defer func() {
+		zeroBytes(buf.Bytes())
+		buf.Reset()
+		pool.Put(buf)
+	}()
+	h.legacy = false
+	encrypted, err := dst.encryptWriter(buf, dst.key[:], h)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(encrypted, decrypted); err != nil {
+		return fmt.Errorf("svalkey: error value reencrypt; %s", err.Error())
+	}
+	if err = encrypted.Close(); err != nil {
+		return fmt.Errorf("svalkey: error value reencrypt; %s", err.Error())
+	}
+	return dst.put(key, append([]byte(nil), buf.Bytes()...), nil)
+}
+
+// authenticate reads and authenticates value at key
+func (s *Store) authenticate(key string) error {
+	data, err := s.get(key, nil)
+	if err != nil {
+		return err
+	}
+	decrypted, _, err := s.decryptReader(bytes.NewReader(data), s.key[:])
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(ioutil.Discard, decrypted); err != nil {
+		return fmt.Errorf("svalkey: error value authenticate; %s", err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package svalkey
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newMigrateStores(t *testing.T, key [32]byte) (*Store, *Store) {
+	src, _ := newChunkedStore(t)
+	for _, k := range []string{"app/a", "app/b", "app/c"} {
+		assert.Nil(t, src.Put(k, TestType{C: k, E: bytes.Repeat([]byte(k), 200)}, nil),
+			"Err in Put must be nil")
+	}
+	dst, err := NewCustomStore(rewriteMock{NewMock()}, JSONCodec{}, []byte{1, 0}, key)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	return src, dst
+}
+
+func assertMigrated(t *testing.T, dst *Store) {
+	for _, k := range []string{"app/a", "app/b", "app/c"} {
+		out := TestType{}
+		assert.Nil(t, dst.Get(k, &out, nil), "Err in Get must be nil")
+		assert.Equal(t, k, out.C)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	src, dst := newMigrateStores(t, testSecret)
+	rep, err := Migrate(src, dst, "app", &MigrateOptions{Workers: 4})
+	assert.Nil(t, err, "Err in Migrate must be nil")
+	assert.Equal(t, []string{"app/a", "app/b", "app/c"}, rep.Copied)
+	assert.Empty(t, rep.Failed)
+	assert.Empty(t, rep.Missing)
+	assert.Empty(t, rep.Extra)
+	assertMigrated(t, dst)
+
+	// Copy without reencryption fails verification under other key
+	otherKey := testSecret
+	otherKey[0] ^= 0xff
+	src, dst = newMigrateStores(t, otherKey)
+	rep, err = Migrate(src, dst, "app", nil)
+	assert.Nil(t, err, "Err in Migrate must be nil")
+	assert.Empty(t, rep.Copied)
+	assert.Len(t, rep.Failed, 3)
+
+	src, dst = newMigrateStores(t, otherKey)
+	rep, err = Migrate(src, dst, "app", &MigrateOptions{Reencrypt: true})
+	assert.Nil(t, err, "Err in Migrate must be nil")
+	assert.Len(t, rep.Copied, 3)
+	assert.Empty(t, rep.Failed)
+	assertMigrated(t, dst)
+}
+
+func TestMigrateCodecAndCheckpoint(t *testing.T) {
+	Register(TestType{})
+	src, dst := newMigrateStores(t, testSecret)
+	dst.SetCodec(GobCodec{})
+
+	dir, err := ioutil.TempDir("", "svalkey")
+	assert.Nil(t, err, "Err in TempDir must be nil")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("app/a\n"), 0600))
+	cp, err := NewFileCheckpoint(path)
+	assert.Nil(t, err, "Err in NewFileCheckpoint must be nil")
+	defer cp.Close()
+
+	ops := []string{}
+	for _, st := range []*Store{src, dst} {
+		st.Use(func(next Handler) Handler {
+			return func(op *Operation) error {
+				ops = append(ops, op.Name)
+				return next(op)
+			}
+		})
+	}
+	rep, err := Migrate(src, dst, "app", &MigrateOptions{
+		NewValue:   func(string) interface{} { return &TestType{} },
+		Checkpoint: cp,
+	})
+	assert.Nil(t, err, "Err in Migrate must be nil")
+	assert.Equal(t, []string{"app/b", "app/c"}, rep.Copied)
+	assert.Equal(t, []string{"app/a"}, rep.Skipped)
+	assert.Equal(t, []string{"app/a"}, rep.Missing)
+	assert.Empty(t, rep.Failed)
+	assert.Equal(t, []string{OpMigrate, OpImport}, ops,
+		"Values must not pass through interceptors again")
+
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(t, err, "Err in ReadFile must be nil")
+	cp, err = NewFileCheckpoint(path)
+	assert.Nil(t, err, "Err in NewFileCheckpoint must be nil")
+	defer cp.Close()
+	for _, k := range []string{"app/a", "app/b", "app/c"} {
+		assert.True(t, cp.Done(k), "Key must be marked in checkpoint: "+string(data))
+	}
+	out := TestType{}
+	assert.Nil(t, dst.Get("app/b", &out, nil), "Err in Get must be nil")
+	assert.Equal(t, "app/b", out.C)
+}
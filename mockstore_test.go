@@ -42,7 +42,7 @@ func (m *Mock) Get(key string,
 			LastIndex: 0,
 		}, nil
 	}
-	return nil, ErrorNoKey
+	return nil, store.ErrKeyNotFound
 }
 
 // Delete the value at the specified key
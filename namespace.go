@@ -0,0 +1,130 @@
+package svalkey
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/abronan/valkeyrie/store"
+	"github.com/karantin2020/svalkey/types"
+	"golang.org/x/crypto/hkdf"
+)
+
+var (
+	// ErrNamespace represents invalid namespace prefix error
+	ErrNamespace = fmt.Errorf("svalkey: in Scoped" +
+		" namespace prefix is empty or outside of Store namespace")
+	// ErrOutOfScope represents operation on key outside
+	// of scoped Store namespace error
+	ErrOutOfScope = fmt.Errorf("svalkey: in scoped Store" +
+		" key is outside of namespace")
+)
+
+// namespaceInfo is HKDF info prefix of namespace keys
+const namespaceInfo = "svalkey namespace "
+
+// NamespaceKey derives the key of namespace prefix from key.
+// Pass it to NewScopedStore to create a scoped Store
+// without the master key
+func NamespaceKey(key [32]byte, prefix string) ([32]byte, error) {
+	var nkey [32]byte
+	prefix, err := cleanPrefix(prefix)
+	if err != nil {
+		return nkey, err
+	}
+	kdf := hkdf.New(sha256.New, key[:], nil, []byte(namespaceInfo+prefix))
+	if _, err := io.ReadFull(kdf, nkey[:]); err != nil {
+		return nkey, fmt.Errorf("svalkey: error key derivation, no key was derived")
+	}
+	return nkey, nil
+}
+
+// cleanPrefix trims leading slashes of prefix
+// and terminates it with slash
+func cleanPrefix(prefix string) (string, error) {
+	prefix = strings.TrimLeft(prefix, "/")
+	if prefix == "" {
+		return "", ErrNamespace
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return prefix, nil
+}
+
+// NewScopedStore creates Store for namespace prefix with key
+// returned by NamespaceKey
+func NewScopedStore(vstore store.Store, codec types.Codec,
+	cipherSuites []byte, key [32]byte, prefix string) (*Store, error) {
+	prefix, err := cleanPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	s, err := NewCustomStore(vstore, codec, cipherSuites, key)
+	if err != nil {
+		return nil, err
+	}
+	s.prefix = prefix
+	return s, nil
+}
+
+// Scoped returns a copy of s restricted to keys under prefix.
+// The copy holds only the key derived for prefix, values put
+// with it can't be decrypted by Store of other namespace or
+// by s itself, only by Store scoped to the same prefix.
+// Scoped Store of scoped s derives its key from the key of s,
+// prefix must be under the namespace of s then
+func (s *Store) Scoped(prefix string) (*Store, error) {
+	prefix, err := cleanPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	if !s.inScope(prefix) {
+		return nil, ErrNamespace
+	}
+	if err := s.keyBuf.acquire(); err != nil {
+		return nil, err
+	}
+	defer s.keyBuf.release()
+	key, err := NamespaceKey(*s.key, prefix)
+	if err != nil {
+		return nil, err
+	}
+	c := *s
+	c.keyBuf = newKeyBuffer(&key)
+	c.key = c.keyBuf.key
+	if s.privBuf != nil {
+		private := *s.private
+		c.privBuf = newKeyBuffer(&private)
+		c.private = c.privBuf.key
+	}
+	c.recipients = lockRecipients(s.recipients)
+	c.prefix = prefix
+	c.borrowed = true
+	c.primers = newPrimerCache()
+	return &c, nil
+}
+
+// Scope returns the key prefix of scoped Store,
+// empty string for unscoped one
+func (s *Store) Scope() string {
+	return s.prefix
+}
+
+// scope returns prefix of bulk operation. Empty prefix
+// is the namespace of s
+func (s *Store) scope(prefix string) (string, error) {
+	if prefix == "" {
+		return s.prefix, nil
+	}
+	if !s.inScope(prefix) {
+		return "", ErrOutOfScope
+	}
+	return prefix, nil
+}
+
+// inScope reports if key is under the namespace of s
+func (s *Store) inScope(key string) bool {
+	return strings.HasPrefix(strings.TrimLeft(key, "/"), s.prefix)
+}
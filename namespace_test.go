@@ -0,0 +1,83 @@
+package svalkey
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore_Scoped(t *testing.T) {
+	m := NewMock()
+	st, err := NewCustomStore(m, JSONCodec{}, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	a, err := st.Scoped("tenants/a")
+	assert.Nil(t, err, "Err in Scoped must be nil")
+	assert.Equal(t, "tenants/a/", a.Scope(), "Scope must end with slash")
+	b, err := st.Scoped("/tenants/b/")
+	assert.Nil(t, err, "Err in Scoped must be nil")
+	assert.NotEqual(t, *st.key, *a.key, "Scoped Store must not hold master key")
+
+	assert.Nil(t, a.Put("tenants/a/db", TestType{C: "a"}, nil), "Err in Put must be nil")
+	assert.Nil(t, b.Put("tenants/b/db", TestType{C: "b"}, nil), "Err in Put must be nil")
+	assert.Equal(t, ErrOutOfScope, a.Put("tenants/ab/db", TestType{}, nil),
+		"Put outside of namespace must fail")
+	out := TestType{}
+	assert.Equal(t, ErrOutOfScope, a.Get("tenants/b/db", &out, nil),
+		"Get outside of namespace must fail")
+	_, err = a.List("tenants/", &[]TestType{}, nil)
+	assert.Equal(t, ErrOutOfScope, err, "List of parent directory must fail")
+
+	// the value of other tenant can't be decrypted
+	// even if the scope check is bypassed
+	bad := *a
+	bad.prefix = ""
+	assert.Equal(t, ErrAuthentication, bad.Get("tenants/b/db", &out, nil),
+		"Get of other namespace value must fail authentication")
+	assert.Equal(t, ErrAuthentication, st.Get("tenants/a/db", &out, nil),
+		"Master Store must not decrypt scoped value")
+
+	// scoped Store created from derived key only
+	key, err := NamespaceKey(testSecret, "tenants/a/")
+	assert.Nil(t, err, "Err in NamespaceKey must be nil")
+	a2, err := NewScopedStore(m, JSONCodec{}, []byte{1, 0}, key, "tenants/a/")
+	assert.Nil(t, err, "Err in NewScopedStore must be nil")
+	assert.Nil(t, a2.Get("tenants/a/db", &out, nil), "Err in Get must be nil")
+	assert.Equal(t, "a", out.C, "Get must return value put by other handle")
+
+	// nested namespace
+	_, err = a.Scoped("tenants/b/x")
+	assert.Equal(t, ErrNamespace, err, "Nested namespace outside of parent must fail")
+	ax, err := a.Scoped("tenants/a/x")
+	assert.Nil(t, err, "Err in Scoped must be nil")
+	assert.Nil(t, ax.Put("tenants/a/x/db", TestType{C: "x"}, nil), "Err in Put must be nil")
+	assert.NotNil(t, a.Get("tenants/a/x/db", &out, nil), "Parent must not decrypt nested value")
+	_, err = st.Scoped("")
+	assert.Equal(t, ErrNamespace, err, "Empty namespace must fail")
+}
+
+func TestStore_ScopedPrimedCodec(t *testing.T) {
+	Register(TestType{})
+	m := NewMock()
+	codec, err := NewPrimedCodec(GobCodec{}, TestType{})
+	assert.Nil(t, err, "Err in NewPrimedCodec must be nil")
+	st, err := NewCustomStore(m, codec, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	a, err := st.Scoped("tenants/a/")
+	assert.Nil(t, err, "Err in Scoped must be nil")
+	assert.Nil(t, a.Put("tenants/a/db", TestType{C: "a"}, nil), "Err in Put must be nil")
+	assert.Contains(t, m.kv, a.primerKey(primerOf(codec).id),
+		"Primer must be persisted under namespace")
+	list := []TestType{}
+	pairs, err := a.List("tenants/a/", &list, nil)
+	assert.Nil(t, err, "Err in List must be nil")
+	assert.Equal(t, 1, len(pairs), "List must skip namespace primers")
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, a.Export("", buf, nil), "Err in Export must be nil")
+	assert.Equal(t, ErrOutOfScope, a.Export("tenants/", buf, nil),
+		"Export outside of namespace must fail")
+	rep, err := a.Verify("", nil)
+	assert.Nil(t, err, "Err in Verify must be nil")
+	assert.True(t, rep.OK(), "Verify of namespace must succeed")
+}
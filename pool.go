@@ -8,6 +8,7 @@ import (
 )
 
 type pooledCodec struct {
+	codec       types.Codec
 	encoderPool sync.Pool
 	decoderPool sync.Pool
 }
@@ -21,6 +22,7 @@ type pooledCodec struct {
 // since all primed types are cached for all encoders/decoders.
 func NewPooledCodec(codec types.Codec) types.Codec {
 	return &pooledCodec{
+		codec: codec,
 		encoderPool: sync.Pool{New: func() interface{} {
 			var enc delegateEncoder
 			enc.Encoder = codec.NewEncoder(&enc)
@@ -2,12 +2,32 @@ package svalkey
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"strings"
+	"sync"
 
+	"github.com/abronan/valkeyrie/store"
 	"github.com/karantin2020/svalkey/types"
 )
 
+// reservedPrefix is the directory for svalkey internal entries.
+// List skips entries under it
+const reservedPrefix = "_svalkey/"
+
+// primersDir is the directory where primers of primed codecs
+// are persisted
+const primersDir = reservedPrefix + "primers/"
+
+const primerIDSize = 8
+
+// ErrPrimerNotFound represents missing primer of a value error
+var ErrPrimerNotFound = fmt.Errorf("svalkey: in Get" +
+	" primer of value is not found")
+
 type delegateEncoder struct {
 	types.Encoder
 	io.Writer
@@ -22,6 +42,7 @@ type primedCodec struct {
 	codec types.Codec
 	types []interface{}
 	data  []byte
+	id    []byte
 }
 
 // NewPrimedCodec delegates to the passed codec for creating Encoders/Decoders.
@@ -39,6 +60,10 @@ type primedCodec struct {
 // Warning, PrimedCodec should be used consistently (for reading & writing). It
 // won't be able to read data written by unprimed encoders, and data written by it
 // won't be able to be read by unprimed decoders.
+// Store persists the primer under the reserved _svalkey/primers/ directory
+// and references it in the envelope of every value, so values written
+// with previous primers remain readable after the sample types change,
+// as long as the types are registered with the underlying codec.
 func NewPrimedCodec(codec types.Codec, types ...interface{}) (types.Codec, error) {
 	var buf bytes.Buffer
 	enc := codec.NewEncoder(&buf)
@@ -49,11 +74,17 @@ func NewPrimedCodec(codec types.Codec, types ...interface{}) (types.Codec, error
 	if err := codec.NewDecoder(bytes.NewReader(buf.Bytes())).Decode(&testTypes); err != nil {
 		return nil, err
 	}
+	return newPrimedCodec(codec, types, buf.Bytes()), nil
+}
+
+func newPrimedCodec(codec types.Codec, types []interface{}, data []byte) *primedCodec {
+	sum := sha256.Sum256(data)
 	return &primedCodec{
 		codec: codec,
 		types: types,
-		data:  buf.Bytes(),
-	}, nil
+		data:  data,
+		id:    sum[:primerIDSize],
+	}
 }
 
 func (p *primedCodec) NewEncoder(w io.Writer) types.Encoder {
@@ -78,3 +109,120 @@ func (p *primedCodec) NewDecoder(r io.Reader) types.Decoder {
 	dec.Reader = r
 	return &dec
 }
+
+// primerOf returns primed codec used by codec or nil
+func primerOf(codec types.Codec) *primedCodec {
+	switch c := codec.(type) {
+	case *primedCodec:
+		return c
+	case *pooledCodec:
+		return primerOf(c.codec)
+	}
+	return nil
+}
+
+// isReservedKey reports if key is reserved entry of Store
+// or of scoped Store
+func isReservedKey(key string) bool {
+	return strings.HasPrefix(strings.TrimPrefix(key, "/"), reservedPrefix) ||
+		strings.Contains(key, "/"+reservedPrefix)
+}
+
+// primerKey returns key of primer id under the namespace of s
+func (s *Store) primerKey(id []byte) string {
+	return s.prefix + primersDir + hex.EncodeToString(id)
+}
+
+// primerCache holds primers persisted or loaded by Store
+type primerCache struct {
+	sync.Mutex
+	saved  map[string]bool
+	loaded map[string]*primedCodec
+}
+
+func newPrimerCache() *primerCache {
+	return &primerCache{
+		saved:  map[string]bool{},
+		loaded: map[string]*primedCodec{},
+	}
+}
+
+// savePrimer persists primer of primed codec. Once the primer
+// is saved, it is only checked to exist, so a deleted primer
+// is written again. Primers are internal entries written by
+// authorized operation, so they don't go through interceptors
+// and policy
+func (s *Store) savePrimer(p *primedCodec) error {
+	id := string(p.id)
+	s.primers.Lock()
+	defer s.primers.Unlock()
+	if s.primers.saved[id] {
+		ok, err := s.exists(s.primerKey(p.id), nil)
+		if err != nil {
+			return fmt.Errorf("svalkey: error save primer; %s", err.Error())
+		}
+		if ok {
+			return nil
+		}
+	}
+	err := s.handlePutStream(&Operation{Name: OpPutStream,
+		Key: s.primerKey(p.id), Reader: bytes.NewReader(p.data)})
+	if err != nil {
+		return fmt.Errorf("svalkey: error save primer; %s", err.Error())
+	}
+	s.primers.saved[id] = true
+	return nil
+}
+
+// loadPrimer returns primed codec for primer id. Primers are
+// loaded from backend store and combined with the underlying
+// codec of the Store codec
+func (s *Store) loadPrimer(id []byte) (types.Codec, error) {
+	if p := primerOf(s.codec); p != nil && bytes.Equal(p.id, id) {
+		return s.codec, nil
+	}
+	s.primers.Lock()
+	defer s.primers.Unlock()
+	if p, ok := s.primers.loaded[string(id)]; ok {
+		return p, nil
+	}
+	op := &Operation{Name: OpGetBytes, Key: s.primerKey(id)}
+	err := s.handleGetBytes(op)
+	data, _ := op.Result.([]byte)
+	if err != nil {
+		if err == store.ErrKeyNotFound {
+			return nil, ErrPrimerNotFound
+		}
+		return nil, fmt.Errorf("svalkey: error load primer; %s", err.Error())
+	}
+	if sum := sha256.Sum256(data); !bytes.Equal(sum[:primerIDSize], id) {
+		return nil, ErrPrimerNotFound
+	}
+	codec := s.baseCodec()
+	var types []interface{}
+	if err := codec.NewDecoder(bytes.NewReader(data)).Decode(&types); err != nil {
+		return nil, fmt.Errorf("svalkey: error load primer; %s", err.Error())
+	}
+	p := newPrimedCodec(codec, types, data)
+	s.primers.loaded[string(id)] = p
+	return p, nil
+}
+
+// baseCodec returns the codec underlying primed Store codec
+func (s *Store) baseCodec() types.Codec {
+	if p := primerOf(s.codec); p != nil {
+		return p.codec
+	}
+	return s.codec
+}
+
+// codecFor returns codec to decode value with envelope header h
+func (s *Store) codecFor(h *header) (types.Codec, error) {
+	if len(h.primer) > 0 {
+		return s.loadPrimer(h.primer)
+	}
+	if primerOf(s.codec) != nil {
+		return s.baseCodec(), nil
+	}
+	return s.codec, nil
+}
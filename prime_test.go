@@ -0,0 +1,78 @@
+package svalkey
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore_PrimedCodecPersisted(t *testing.T) {
+	Register(TestType{})
+	Register(KeyType{})
+	m := NewMock()
+	v := TestType{A: 1, B: 2, C: "primed", D: 3.5, E: []byte("value")}
+
+	oldCodec, err := NewPrimedCodec(GobCodec{}, TestType{})
+	assert.Nil(t, err, "Err in NewPrimedCodec must be nil")
+	st, err := NewCustomStore(m, oldCodec, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	assert.Nil(t, st.Put("old", v, nil), "Err in Put must be nil")
+	assert.Contains(t, m.kv, st.primerKey(primerOf(oldCodec).id),
+		"Primer must be persisted")
+
+	// Restart with changed sample types
+	newCodec, err := NewPrimedCodec(GobCodec{}, KeyType{}, TestType{})
+	assert.Nil(t, err, "Err in NewPrimedCodec must be nil")
+	assert.NotEqual(t, primerOf(oldCodec).id, primerOf(newCodec).id)
+	nt, err := NewCustomStore(m, NewPooledCodec(newCodec), []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	assert.Nil(t, nt.Put("new", v, nil), "Err in Put must be nil")
+
+	out := TestType{}
+	assert.Nil(t, nt.Get("old", &out, nil), "Err in Get of old value must be nil")
+	assert.Equal(t, v, out)
+	out = TestType{}
+	assert.Nil(t, nt.Get("new", &out, nil), "Err in Get of new value must be nil")
+	assert.Equal(t, v, out)
+
+	list := []TestType{}
+	retList, err := nt.List("", &list, nil)
+	assert.Nil(t, err, "Err in List must be nil")
+	assert.Len(t, retList, 2, "List must skip reserved entries")
+	for _, p := range retList {
+		assert.False(t, strings.HasPrefix(p.key, reservedPrefix))
+	}
+
+	// Unprimed store reads primed values with persisted primers
+	gt, err := NewStore(m, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewStore must be nil")
+	out = TestType{}
+	assert.Nil(t, gt.Get("old", &out, nil), "Err in Get must be nil")
+	assert.Equal(t, v, out)
+
+	// Missing primer
+	delete(m.kv, st.primerKey(primerOf(oldCodec).id))
+	gt, err = NewStore(m, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewStore must be nil")
+	assert.NotNil(t, gt.Get("old", &out, nil), "Err in Get must not be nil")
+	assert.Nil(t, st.Put("old2", v, nil), "Err in Put must be nil")
+	assert.Contains(t, m.kv, st.primerKey(primerOf(oldCodec).id),
+		"Deleted primer must be persisted again")
+	assert.Nil(t, gt.Get("old", &out, nil), "Err in Get must be nil")
+}
+
+func TestStore_PutReservedKey(t *testing.T) {
+	m := NewMock()
+	st, err := NewStore(m, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewStore must be nil")
+	for _, key := range []string{"a/_svalkey/x", reservedPrefix + "primers/0"} {
+		assert.Equal(t, ErrInvalidPath, st.Put(key, TestType{}, nil),
+			"Put of key with _svalkey segment must fail")
+		assert.Equal(t, ErrInvalidPath, st.PutBytes(key, []byte("v"), nil),
+			"PutBytes of key with _svalkey segment must fail")
+		assert.Equal(t, ErrInvalidPath, st.PutMany(map[string]interface{}{key: TestType{}}, nil),
+			"PutMany of key with _svalkey segment must fail")
+	}
+	assert.Empty(t, m.kv, "Keys with _svalkey segment must not be written")
+}
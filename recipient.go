@@ -0,0 +1,427 @@
+package svalkey
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+var (
+	// ErrNotRecipient represents value which data key
+	// isn't wrapped for Store keys error
+	ErrNotRecipient = fmt.Errorf("svalkey: in Get" +
+		" Store is not a recipient of value")
+	// ErrNoRecipients represents removal of all recipients of value error
+	ErrNoRecipients = fmt.Errorf("svalkey: in RemoveRecipients" +
+		" value must have at least one recipient")
+)
+
+// Recipient stanza types
+const (
+	stanzaSymmetric byte = 0x01
+	stanzaX25519    byte = 0x02
+)
+
+// Recipient stanza layouts:
+//
+//	symmetric: type | id | nonce | wrapped data key
+//	               1    8     12        32 + 16
+//	X25519:    type | id | ephemeral key | wrapped data key
+//	               1    8        32            32 + 16
+//
+// Data key is wrapped with ChaCha20-Poly1305, type and id
+// are its additional data. X25519 stanza key is agreed between
+// ephemeral and recipient keys, so its nonce is zero
+const (
+	recipientIDSize = 8
+	wrappedKeySize  = 32 + chacha20poly1305.Overhead
+	symmetricSize   = 1 + recipientIDSize + chacha20poly1305.NonceSize + wrappedKeySize
+	x25519Size      = 1 + recipientIDSize + 32 + wrappedKeySize
+)
+
+// Recipient is a reader of values which data key is wrapped for it
+type Recipient struct {
+	typ byte
+	key [32]byte
+	// buf holds the key of symmetric recipient set by SetRecipients
+	buf *keyBuffer
+}
+
+// SymmetricRecipient returns Recipient for Store with key
+func SymmetricRecipient(key [32]byte) Recipient {
+	return Recipient{typ: stanzaSymmetric, key: key}
+}
+
+// PublicRecipient returns Recipient for Store with private key
+// of X25519 public key, see SetPrivateKey
+func PublicRecipient(public [32]byte) Recipient {
+	return Recipient{typ: stanzaX25519, key: public}
+}
+
+// secret returns the key of r
+func (r Recipient) secret() []byte {
+	if r.buf != nil {
+		return r.buf.key[:]
+	}
+	return r.key[:]
+}
+
+// locked returns copy of r which holds the key of symmetric
+// recipient in keyBuffer
+func (r Recipient) locked() Recipient {
+	if r.typ != stanzaSymmetric {
+		return r
+	}
+	key := toKey(r.secret())
+	return Recipient{typ: r.typ, buf: newKeyBuffer(&key)}
+}
+
+// id returns stanza type and id of r
+func (r Recipient) id() []byte {
+	return stanzaID(r.typ, r.secret())
+}
+
+// stanzaID returns stanza type and id of recipient
+// of type typ with key
+func stanzaID(typ byte, key []byte) []byte {
+	id := []byte{typ}
+	if typ == stanzaSymmetric {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte("svalkey recipient id"))
+		return append(id, mac.Sum(nil)[:recipientIDSize]...)
+	}
+	sum := sha256.Sum256(key)
+	return append(id, sum[:recipientIDSize]...)
+}
+
+// wrapKey derives key which wraps data keys for symmetric recipient
+func wrapKey(key []byte) ([]byte, error) {
+	wkey := make([]byte, chacha20poly1305.KeySize)
+	kdf := hkdf.New(sha256.New, key, nil, []byte("svalkey recipient wrap"))
+	if _, err := io.ReadFull(kdf, wkey); err != nil {
+		return nil, fmt.Errorf("svalkey: error key derivation, no key was derived")
+	}
+	return wkey, nil
+}
+
+// wrap returns stanza of r which wraps dek
+func (r Recipient) wrap(dek []byte) ([]byte, error) {
+	return wrapStanza(r.typ, r.secret(), dek)
+}
+
+// wrapStanza returns stanza which wraps dek for recipient
+// of type typ with key
+func wrapStanza(typ byte, key, dek []byte) ([]byte, error) {
+	stanza := stanzaID(typ, key)
+	var wkey, nonce []byte
+	switch typ {
+	case stanzaSymmetric:
+		nonce = make([]byte, chacha20poly1305.NonceSize)
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return nil, fmt.Errorf("svalkey: error wrap data key, no nonce was got")
+		}
+		k, err := wrapKey(key)
+		if err != nil {
+			return nil, err
+		}
+		wkey = k
+		stanza = append(stanza, nonce...)
+	default:
+		public, private, err := GenerateSealKeys()
+		defer zeroBytes(private[:])
+		if err != nil {
+			return nil, err
+		}
+		shared, err := curve25519.X25519(private[:], key)
+		if err != nil {
+			return nil, err
+		}
+		defer zeroBytes(shared)
+		if wkey, err = sealKey(shared, public[:], key); err != nil {
+			return nil, err
+		}
+		nonce = make([]byte, chacha20poly1305.NonceSize)
+		stanza = append(stanza, public[:]...)
+	}
+	defer zeroBytes(wkey)
+	aead, err := chacha20poly1305.New(wkey)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(stanza, nonce, dek, stanza[:1+recipientIDSize]), nil
+}
+
+// splitStanzas splits recipients header field into stanzas
+func splitStanzas(data []byte) ([][]byte, error) {
+	stanzas := [][]byte{}
+	for len(data) > 0 {
+		size := 0
+		switch data[0] {
+		case stanzaSymmetric:
+			size = symmetricSize
+		case stanzaX25519:
+			size = x25519Size
+		default:
+			return nil, ErrEnvelope
+		}
+		if len(data) < size {
+			return nil, ErrEnvelope
+		}
+		stanzas = append(stanzas, data[:size])
+		data = data[size:]
+	}
+	return stanzas, nil
+}
+
+// unwrap returns data key of value with recipient stanzas
+// opening the stanza of the Store key or private key
+func (s *Store) unwrap(recipients []byte) ([]byte, error) {
+	stanzas, err := splitStanzas(recipients)
+	if err != nil {
+		return nil, err
+	}
+	self := stanzaID(stanzaSymmetric, s.key[:])
+	var public []byte
+	if s.private != nil {
+		if public, err = curve25519.X25519(s.private[:], curve25519.Basepoint); err != nil {
+			return nil, err
+		}
+	}
+	for _, st := range stanzas {
+		id := st[:1+recipientIDSize]
+		var wkey, nonce, wrapped []byte
+		switch {
+		case bytes.Equal(id, self) && s.recipient == nil:
+			body := st[len(id):]
+			nonce = body[:chacha20poly1305.NonceSize]
+			wrapped = body[chacha20poly1305.NonceSize:]
+			if wkey, err = wrapKey(s.key[:]); err != nil {
+				return nil, err
+			}
+		case public != nil && bytes.Equal(id, stanzaID(stanzaX25519, public)):
+			ephemeral := st[len(id) : len(id)+32]
+			wrapped = st[len(id)+32:]
+			nonce = make([]byte, chacha20poly1305.NonceSize)
+			shared, err := curve25519.X25519(s.private[:], ephemeral)
+			if err != nil {
+				return nil, err
+			}
+			wkey, err = sealKey(shared, ephemeral, public)
+			zeroBytes(shared)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			continue
+		}
+		aead, err := chacha20poly1305.New(wkey)
+		zeroBytes(wkey)
+		if err != nil {
+			return nil, err
+		}
+		dek, err := aead.Open(nil, nonce, wrapped, id)
+		if err != nil {
+			s.metrics.IncAuthFailures()
+			return nil, ErrAuthentication
+		}
+		return dek, nil
+	}
+	return nil, ErrNotRecipient
+}
+
+func toKey(b []byte) (key [32]byte) {
+	copy(key[:], b)
+	return key
+}
+
+// SetRecipients makes values put by s readable by recipients
+// besides s itself: every value is encrypted with a random
+// data key wrapped for each of them in the value envelope.
+// Keys of symmetric recipients are copied into locked memory
+// like the Store key and zeroed by Close.
+// Values put with recipients are not chunked, see SetChunkSize.
+// Empty recipients disable wrapping
+func (s *Store) SetRecipients(recipients ...Recipient) {
+	s.recipients = lockRecipients(recipients)
+}
+
+// lockRecipients returns copies of recipients holding their keys
+// in keyBuffer
+func lockRecipients(recipients []Recipient) []Recipient {
+	if len(recipients) == 0 {
+		return nil
+	}
+	locked := make([]Recipient, len(recipients))
+	for i, r := range recipients {
+		locked[i] = r.locked()
+	}
+	return locked
+}
+
+// destroyRecipients zeroes keys of recipients
+func destroyRecipients(recipients []Recipient) {
+	for _, r := range recipients {
+		if r.buf != nil {
+			r.buf.destroy()
+		}
+	}
+}
+
+// self returns stanza type and key of the Store own key
+func (s *Store) self() (byte, []byte) {
+	if s.recipient != nil {
+		return stanzaX25519, s.recipient[:]
+	}
+	return stanzaSymmetric, s.key[:]
+}
+
+// wrapDEK generates data key, puts its stanzas for s
+// and recipients of s into h and returns the data key
+func (s *Store) wrapDEK(h *header) ([]byte, error) {
+	dek := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return nil, fmt.Errorf("svalkey: error generate data key")
+	}
+	typ, key := s.self()
+	self, err := wrapStanza(typ, key, dek)
+	if err != nil {
+		return nil, err
+	}
+	recipients, err := wrapAll(dek, self, s.recipients)
+	if err != nil {
+		return nil, err
+	}
+	h.recipients = recipients
+	return dek, nil
+}
+
+// wrapAll appends stanzas of recipients to stanza
+// skipping duplicates
+func wrapAll(dek, stanza []byte, recipients []Recipient) ([]byte, error) {
+	out := stanza
+	seen := map[string]bool{string(stanza[:1+recipientIDSize]): true}
+	for _, r := range recipients {
+		id := string(r.id())
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		stanza, err := r.wrap(dek)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, stanza...)
+	}
+	return out, nil
+}
+
+// AddRecipients wraps the data key of the value at key for
+// recipients. The value isn't re-encrypted, s must be
+// its recipient
+func (s *Store) AddRecipients(key string, recipients ...Recipient) error {
+	return s.run(&Operation{Name: OpRewrap, Key: key}, func(op *Operation) error {
+		return s.rewrap(op.Key, func(dek []byte, stanzas [][]byte) ([]byte, error) {
+			ids := stanzaIDs(stanzas)
+			out := bytes.Join(stanzas, nil)
+			for _, r := range recipients {
+				id := string(r.id())
+				if ids[id] {
+					continue
+				}
+				ids[id] = true
+				stanza, err := r.wrap(dek)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, stanza...)
+			}
+			return out, nil
+		})
+	})
+}
+
+// RemoveRecipients drops stanzas of recipients from the value
+// at key. Removed recipients which have read the value
+// before may still know its data key, so the value must be
+// re-encrypted to revoke their access
+func (s *Store) RemoveRecipients(key string, recipients ...Recipient) error {
+	return s.run(&Operation{Name: OpRewrap, Key: key}, func(op *Operation) error {
+		return s.rewrap(op.Key, func(dek []byte, stanzas [][]byte) ([]byte, error) {
+			ids := map[string]bool{}
+			for _, r := range recipients {
+				ids[string(r.id())] = true
+			}
+			var out []byte
+			for _, st := range stanzas {
+				if !ids[string(st[:1+recipientIDSize])] {
+					out = append(out, st...)
+				}
+			}
+			if len(out) == 0 {
+				return nil, ErrNoRecipients
+			}
+			return out, nil
+		})
+	})
+}
+
+// stanzaIDs returns set of type and id of stanzas
+func stanzaIDs(stanzas [][]byte) map[string]bool {
+	ids := map[string]bool{}
+	for _, st := range stanzas {
+		ids[string(st[:1+recipientIDSize])] = true
+	}
+	return ids
+}
+
+// rewrap replaces recipient stanzas of the value at key with
+// ones returned by f. Header fields, nonce and encrypted data
+// are kept, so the value key derivation is not changed
+func (s *Store) rewrap(key string,
+	f func(dek []byte, stanzas [][]byte) ([]byte, error)) error {
+	data, err := s.get(key, nil)
+	if err != nil {
+		return err
+	}
+	if len(data) < len(envelopeMagic)+2 || !bytes.Equal(data[:len(envelopeMagic)], envelopeMagic) {
+		return ErrNotRecipient
+	}
+	hl := int(binary.BigEndian.Uint16(data[len(envelopeMagic):]))
+	start := len(envelopeMagic) + 2
+	if len(data) < start+hl {
+		return ErrEnvelope
+	}
+	h, err := unmarshalHeader(data[start : start+hl])
+	if err != nil {
+		return err
+	}
+	if len(h.recipients) == 0 {
+		return ErrNotRecipient
+	}
+	dek, err := s.unwrap(h.recipients)
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(dek)
+	stanzas, err := splitStanzas(h.recipients)
+	if err != nil {
+		return err
+	}
+	if h.recipients, err = f(dek, stanzas); err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	if _, err := writeHeader(buf, h); err != nil {
+		return err
+	}
+	buf.Write(data[start+hl:])
+	return s.put(key, buf.Bytes(), nil)
+}
@@ -0,0 +1,99 @@
+package svalkey
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore_Recipients(t *testing.T) {
+	m := rewriteMock{NewMock()}
+	keyB := [32]byte{2}
+	pubC, privC, err := GenerateSealKeys()
+	assert.Nil(t, err, "Err in GenerateSealKeys must be nil")
+
+	a, err := NewCustomStore(m, JSONCodec{}, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	a.SetRecipients(SymmetricRecipient(keyB), PublicRecipient(pubC))
+	b, err := NewCustomStore(m, JSONCodec{}, []byte{1, 0}, keyB)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	c, err := NewCustomStore(m, JSONCodec{}, []byte{1, 0}, [32]byte{3})
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	c.SetPrivateKey(privC)
+	d, err := NewCustomStore(m, JSONCodec{}, []byte{1, 0}, [32]byte{4})
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+
+	v := TestType{C: "shared"}
+	assert.Nil(t, a.Put("shared", v, nil), "Err in Put must be nil")
+	for name, st := range map[string]*Store{"a": a, "b": b, "c": c} {
+		out := TestType{}
+		assert.Nil(t, st.Get("shared", &out, nil), "Err in Get by %s must be nil", name)
+		assert.Equal(t, v, out, "Get by %s must return put value", name)
+	}
+	out := TestType{}
+	assert.Equal(t, ErrNotRecipient, d.Get("shared", &out, nil),
+		"Get by not recipient must fail")
+
+	// rewrap keeps encrypted payload
+	payload := func() []byte {
+		data := m.kv["shared"]
+		return data[len(data)-64:]
+	}
+	before := append([]byte{}, payload()...)
+	assert.Nil(t, b.AddRecipients("shared", SymmetricRecipient([32]byte{4})),
+		"Err in AddRecipients must be nil")
+	assert.True(t, bytes.Equal(before, payload()), "AddRecipients must not re-encrypt value")
+	assert.Nil(t, d.Get("shared", &out, nil), "Err in Get by added recipient must be nil")
+
+	assert.Nil(t, a.RemoveRecipients("shared", SymmetricRecipient(keyB), PublicRecipient(pubC)),
+		"Err in RemoveRecipients must be nil")
+	assert.True(t, bytes.Equal(before, payload()), "RemoveRecipients must not re-encrypt value")
+	assert.Equal(t, ErrNotRecipient, b.Get("shared", &out, nil), "Get by removed recipient must fail")
+	assert.Equal(t, ErrNotRecipient, c.Get("shared", &out, nil), "Get by removed recipient must fail")
+	assert.Nil(t, a.Get("shared", &out, nil), "Err in Get must be nil")
+	assert.Equal(t, ErrNotRecipient, b.AddRecipients("shared", SymmetricRecipient(keyB)),
+		"AddRecipients by not recipient must fail")
+	assert.Equal(t, ErrNoRecipients, a.RemoveRecipients("shared",
+		SymmetricRecipient(testSecret), SymmetricRecipient([32]byte{4})),
+		"Removal of all recipients must fail")
+
+	// values without recipients can't be rewrapped
+	assert.Nil(t, b.Put("own", v, nil), "Err in Put must be nil")
+	assert.Equal(t, ErrNotRecipient, b.AddRecipients("own", SymmetricRecipient(testSecret)),
+		"AddRecipients of value without stanzas must fail")
+
+	// stanza is authenticated
+	a.SetRecipients(SymmetricRecipient(keyB))
+	assert.Nil(t, a.Put("shared", v, nil), "Err in Put must be nil")
+	data := m.kv["shared"]
+	data[len(envelopeMagic)+2+2+symmetricSize+symmetricSize-1] ^= 1
+	assert.Equal(t, ErrAuthentication, b.Get("shared", &out, nil),
+		"Get with modified stanza must fail authentication")
+}
+
+func TestStore_RecipientsChunkSize(t *testing.T) {
+	m := rewriteMock{NewMock()}
+	keyB := [32]byte{2}
+	pubC, privC, err := GenerateSealKeys()
+	assert.Nil(t, err, "Err in GenerateSealKeys must be nil")
+
+	a, err := NewCustomStore(m, JSONCodec{}, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	a.SetChunkSize(64)
+	a.SetRecipients(SymmetricRecipient(keyB), PublicRecipient(pubC))
+	b, err := NewCustomStore(m, JSONCodec{}, []byte{1, 0}, keyB)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	c, err := NewCustomStore(m, JSONCodec{}, []byte{1, 0}, [32]byte{3})
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	c.SetPrivateKey(privC)
+
+	v := TestType{C: string(bytes.Repeat([]byte("shared "), 100))}
+	assert.Nil(t, a.Put("shared", v, nil), "Err in Put must be nil")
+	assert.False(t, isManifest(m.kv["shared"]), "Value with recipients must not be chunked")
+	for name, st := range map[string]*Store{"a": a, "b": b, "c": c} {
+		out := TestType{}
+		assert.Nil(t, st.Get("shared", &out, nil), "Err in Get by %s must be nil", name)
+		assert.Equal(t, v, out, "Get by %s must return put value", name)
+	}
+}
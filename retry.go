@@ -0,0 +1,163 @@
+package svalkey
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/abronan/valkeyrie/store"
+)
+
+// Retry policy defaults
+const (
+	DefaultRetryAttempts   = 3
+	DefaultRetryBackoff    = 50 * time.Millisecond
+	DefaultRetryMaxBackoff = 2 * time.Second
+	DefaultRetryMultiplier = 2.0
+	DefaultRetryJitter     = 0.2
+)
+
+// RetryPolicy holds settings of backend calls retry.
+// Retried calls wait exponentially growing random backoff
+// between attempts
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts of a backend call,
+	// default is DefaultRetryAttempts
+	MaxAttempts int
+	// Attempts overrides MaxAttempts for backend calls by name:
+	// "get", "put", "delete", "exists", "list", "delete_tree",
+	// "get_chunk", "put_chunk", "get_manifest", "get_many", "put_many",
+	// "delete_many", "delete_chunk".
+	// Value 1 disables retry of the call
+	Attempts map[string]int
+	// MaxElapsed limits time spent on a backend call with its
+	// retries, no further attempts are made once it is over.
+	// Zero means no limit
+	MaxElapsed time.Duration
+	// Backoff is the wait before the first retry,
+	// default is DefaultRetryBackoff
+	Backoff time.Duration
+	// MaxBackoff limits the wait between attempts,
+	// default is DefaultRetryMaxBackoff
+	MaxBackoff time.Duration
+	// Multiplier is the backoff growth factor,
+	// default is DefaultRetryMultiplier
+	Multiplier float64
+	// Jitter is the fraction of backoff which is randomized,
+	// up to 1 (wait is random in [0, backoff]), default is
+	// DefaultRetryJitter. Negative Jitter disables it
+	Jitter float64
+	// RetryWrites enables retry of value and manifest puts.
+	// A put which timed out may have been applied, repeating it
+	// may overwrite value written by other client meanwhile,
+	// so puts are not retried by default. Chunk puts write
+	// to keys of new generation referenced only by the following
+	// manifest put, so they are always retried
+	RetryWrites bool
+	// Retryable reports if err is transient,
+	// default is IsRetryable
+	Retryable func(err error) bool
+}
+
+// SetRetryPolicy enables retry of backend calls failed
+// with transient errors. Nil p disables retry
+func (s *Store) SetRetryPolicy(p *RetryPolicy) {
+	if p == nil {
+		s.retry = nil
+		return
+	}
+	s.retry = p.withDefaults()
+}
+
+// IsRetryable reports if err returned by backend may be transient.
+// Not found, conflict, integrity and argument errors
+// and unsupported calls are permanent
+func IsRetryable(err error) bool {
+	switch err {
+	case store.ErrCallNotSupported, store.ErrBackendNotSupported,
+		store.ErrPreviousNotSpecified:
+		return false
+	}
+	return ErrorClass(err) == ErrClassOther
+}
+
+func (p *RetryPolicy) withDefaults() *RetryPolicy {
+	c := *p
+	if c.MaxAttempts < 1 {
+		c.MaxAttempts = DefaultRetryAttempts
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = DefaultRetryBackoff
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = DefaultRetryMaxBackoff
+	}
+	if c.Multiplier < 1 {
+		c.Multiplier = DefaultRetryMultiplier
+	}
+	if c.Jitter == 0 {
+		c.Jitter = DefaultRetryJitter
+	}
+	if c.Jitter < 0 {
+		c.Jitter = 0
+	}
+	if c.Jitter > 1 {
+		c.Jitter = 1
+	}
+	if c.Retryable == nil {
+		c.Retryable = IsRetryable
+	}
+	return &c
+}
+
+func (p *RetryPolicy) attempts(op string, idempotent bool) int {
+	if !idempotent && !p.RetryWrites {
+		return 1
+	}
+	if n, ok := p.Attempts[op]; ok && n > 0 {
+		return n
+	}
+	return p.MaxAttempts
+}
+
+var (
+	jitterMu   sync.Mutex
+	jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// backoff returns the wait before retry number n, counting from 0
+func (p *RetryPolicy) backoff(n int) time.Duration {
+	d := float64(p.Backoff)
+	for i := 0; i < n && d < float64(p.MaxBackoff); i++ {
+		d *= p.Multiplier
+	}
+	if d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	jitterMu.Lock()
+	r := jitterRand.Float64()
+	jitterMu.Unlock()
+	return time.Duration(d - d*p.Jitter*r)
+}
+
+// backend calls f which performs backend call op, observes it
+// and retries it according to retry policy. Calls which are
+// not idempotent are retried only if RetryWrites is set
+func (s *Store) backend(op string, idempotent bool, f func() error) error {
+	p := s.retry
+	begin := time.Now()
+	for n := 0; ; n++ {
+		start := time.Now()
+		err := f()
+		s.observeBackend(op, start, err)
+		if err == nil || p == nil || n+1 >= p.attempts(op, idempotent) ||
+			!p.Retryable(err) {
+			return err
+		}
+		wait := p.backoff(n)
+		if p.MaxElapsed > 0 && time.Since(begin)+wait > p.MaxElapsed {
+			return err
+		}
+		time.Sleep(wait)
+	}
+}
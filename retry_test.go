@@ -0,0 +1,127 @@
+package svalkey
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abronan/valkeyrie/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyMock fails the first fails calls of Get and Put,
+// or only of op if it is set, with transient error, counts
+// calls and returns store.ErrKeyNotFound for missing keys
+type flakyMock struct {
+	*Mock
+	op    string
+	fails int
+	calls int
+}
+
+func (m *flakyMock) fail(op string) bool {
+	if m.op != "" && m.op != op {
+		return false
+	}
+	m.calls++
+	return m.calls <= m.fails
+}
+
+func (m *flakyMock) Put(key string,
+	value []byte, options *store.WriteOptions) error {
+	if m.fail("put") {
+		return store.ErrNotReachable
+	}
+	return m.Mock.Put(key, value, options)
+}
+
+// Delete of failed call is applied, like a delete which timed out
+func (m *flakyMock) Delete(key string) error {
+	if _, ok := m.Mock.kv[key]; !ok {
+		return store.ErrKeyNotFound
+	}
+	if m.fail("delete") {
+		m.Mock.Delete(key)
+		return store.ErrNotReachable
+	}
+	return m.Mock.Delete(key)
+}
+
+func (m *flakyMock) Get(key string,
+	options *store.ReadOptions) (*store.KVPair, error) {
+	if m.fail("get") {
+		return nil, store.ErrNotReachable
+	}
+	return m.Mock.Get(key, options)
+}
+
+func TestStore_Retry(t *testing.T) {
+	m := &flakyMock{Mock: NewMock()}
+	st, err := NewCustomStore(m, JSONCodec{}, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	st.SetRetryPolicy(&RetryPolicy{Backoff: time.Millisecond, Jitter: 0.5})
+
+	// puts read the stored value to clean up its chunks,
+	// so only put calls fail
+	m.op, m.fails = "put", 1
+	assert.Equal(t, store.ErrNotReachable, st.Put("a", TestType{C: "a"}, nil),
+		"Put must not be retried by default")
+	st.SetRetryPolicy(&RetryPolicy{Backoff: time.Millisecond, RetryWrites: true})
+	m.calls, m.fails = 0, 2
+	assert.Nil(t, st.Put("a", TestType{C: "a"}, nil), "Err in Put must be nil")
+	assert.Equal(t, 3, m.calls, "Put must be retried with RetryWrites")
+
+	m.op, m.calls, m.fails = "", 0, 2
+	out := TestType{}
+	assert.Nil(t, st.Get("a", &out, nil), "Err in Get must be nil")
+	assert.Equal(t, "a", out.C, "Get must return put value")
+
+	m.calls, m.fails = 0, 5
+	assert.Equal(t, store.ErrNotReachable, st.Get("a", &out, nil),
+		"Get must fail when attempts are exhausted")
+	assert.Equal(t, DefaultRetryAttempts, m.calls, "Get must be tried MaxAttempts times")
+
+	st.SetRetryPolicy(&RetryPolicy{Backoff: time.Millisecond,
+		Attempts: map[string]int{"get": 1}})
+	m.calls, m.fails = 0, 1
+	assert.NotNil(t, st.Get("a", &out, nil), "Err in Get must not be nil")
+	assert.Equal(t, 1, m.calls, "Attempts must override MaxAttempts")
+
+	st.SetRetryPolicy(&RetryPolicy{Backoff: 50 * time.Millisecond,
+		MaxElapsed: 10 * time.Millisecond})
+	m.calls, m.fails = 0, 1
+	assert.NotNil(t, st.Get("a", &out, nil), "Err in Get must not be nil")
+	assert.Equal(t, 1, m.calls, "Retry must stop when MaxElapsed is over")
+
+	// permanent errors are not retried
+	st.SetRetryPolicy(&RetryPolicy{Backoff: time.Millisecond})
+	m.calls, m.fails = 0, 0
+	assert.Equal(t, store.ErrKeyNotFound, st.Get("missing", &out, nil),
+		"Get of missing key must fail")
+	assert.Equal(t, 1, m.calls, "Not found must not be retried")
+
+	other, err := NewCustomStore(m, JSONCodec{}, []byte{1, 0}, [32]byte{1})
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	other.SetRetryPolicy(&RetryPolicy{Backoff: time.Millisecond})
+	m.calls = 0
+	assert.Equal(t, ErrAuthentication, other.Get("a", &out, nil),
+		"Get with wrong key must fail authentication")
+	assert.Equal(t, 1, m.calls, "Authentication failure must not be retried")
+
+	m.op, m.calls, m.fails = "delete", 0, 1
+	assert.Nil(t, st.Delete("a"), "Retried Delete of deleted key must succeed")
+	assert.Equal(t, store.ErrKeyNotFound, st.Delete("a"), "Delete of missing key must fail")
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := (&RetryPolicy{Backoff: 10 * time.Millisecond,
+		MaxBackoff: 50 * time.Millisecond, Jitter: -1}).withDefaults()
+	assert.Equal(t, 10*time.Millisecond, p.backoff(0), "First backoff must be Backoff")
+	assert.Equal(t, 40*time.Millisecond, p.backoff(2), "Backoff must grow exponentially")
+	assert.Equal(t, 50*time.Millisecond, p.backoff(10), "Backoff must be limited by MaxBackoff")
+	assert.Equal(t, DefaultRetryJitter, (&RetryPolicy{}).withDefaults().Jitter,
+		"Jitter must default to DefaultRetryJitter")
+	p.Jitter = 1
+	for i := 0; i < 10; i++ {
+		assert.True(t, p.backoff(1) <= 20*time.Millisecond, "Jittered backoff must not exceed backoff")
+	}
+}
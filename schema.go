@@ -0,0 +1,123 @@
+package svalkey
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/karantin2020/svalkey/types"
+)
+
+// MigrationFunc upgrades data of a stored value from one schema
+// version to another. Data is the plaintext encoded by codec, the
+// returned data must be decodable into the next schema version
+type MigrationFunc func(codec types.Codec, data []byte) ([]byte, error)
+
+type migration struct {
+	to uint32
+	fn MigrationFunc
+}
+
+type schema struct {
+	current uint32
+	steps   map[uint32]migration
+}
+
+var (
+	schemasMu sync.RWMutex
+	schemas   = map[reflect.Type]*schema{}
+)
+
+var (
+	// ErrSchemaVersion represents value written with newer schema
+	// version than registered for the out value type
+	ErrSchemaVersion = fmt.Errorf("svalkey: in Get" +
+		" value schema version is newer than registered")
+)
+
+// RegisterMigration registers fn to upgrade values of value's type
+// from schema version from to version to. The latest registered
+// version becomes the current schema version of the type: Put writes
+// it into the value envelope, Get and List upgrade older values
+// applying registered migrations one by one.
+// Values put before any migration was registered have version 0.
+// RegisterMigration panics if to is not greater than from or
+// a migration from version from is already registered
+func RegisterMigration(value interface{}, from, to uint32, fn MigrationFunc) {
+	if to <= from {
+		panic("svalkey: RegisterMigration to version must be greater than from")
+	}
+	if fn == nil {
+		panic("svalkey: RegisterMigration nil migration func")
+	}
+	t := baseType(reflect.TypeOf(value))
+	schemasMu.Lock()
+	defer schemasMu.Unlock()
+	sc, ok := schemas[t]
+	if !ok {
+		sc = &schema{steps: map[uint32]migration{}}
+		schemas[t] = sc
+	}
+	if _, ok := sc.steps[from]; ok {
+		panic(fmt.Sprintf("svalkey: RegisterMigration duplicate migration"+
+			" from version %d for %s", from, t))
+	}
+	sc.steps[from] = migration{to: to, fn: fn}
+	if to > sc.current {
+		sc.current = to
+	}
+}
+
+// SetMigrationWriteBack sets whether Get and List write back
+// values upgraded to the current schema version
+func (s *Store) SetMigrationWriteBack(writeBack bool) {
+	s.migrateWriteBack = writeBack
+}
+
+func baseType(t reflect.Type) reflect.Type {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// schemaVersion returns current schema version of value's type
+func schemaVersion(value interface{}) uint32 {
+	t := baseType(reflect.TypeOf(value))
+	schemasMu.RLock()
+	defer schemasMu.RUnlock()
+	if sc, ok := schemas[t]; ok {
+		return sc.current
+	}
+	return 0
+}
+
+// migrate upgrades data of value's type from schema version from
+// to the current one
+func migrate(codec types.Codec, value interface{},
+	from uint32, data []byte) ([]byte, error) {
+	t := baseType(reflect.TypeOf(value))
+	schemasMu.RLock()
+	sc, ok := schemas[t]
+	schemasMu.RUnlock()
+	if !ok || from > sc.current {
+		return nil, ErrSchemaVersion
+	}
+	for v := from; v != sc.current; {
+		schemasMu.RLock()
+		step, ok := sc.steps[v]
+		schemasMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("svalkey: no migration registered"+
+				" from version %d for %s", v, t)
+		}
+		var err error
+		data, err = step.fn(codec, data)
+		if err != nil {
+			return nil, fmt.Errorf("svalkey: error migration from version"+
+				" %d to %d; %s", v, step.to, err.Error())
+		}
+		v = step.to
+	}
+	return data, nil
+}
@@ -0,0 +1,83 @@
+package svalkey
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/karantin2020/svalkey/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type userV1 struct {
+	Name string `json:"name"`
+}
+
+type userV2 struct {
+	First string `json:"first"`
+	Last  string `json:"last"`
+	Admin bool   `json:"admin"`
+}
+
+func init() {
+	RegisterMigration(userV2{}, 0, 1, func(codec types.Codec, data []byte) ([]byte, error) {
+		old := userV1{}
+		if err := codec.NewDecoder(bytes.NewReader(data)).Decode(&old); err != nil {
+			return nil, err
+		}
+		names := strings.SplitN(old.Name, " ", 2)
+		u := map[string]interface{}{"first": names[0], "last": names[1]}
+		return json.Marshal(u)
+	})
+	RegisterMigration(&userV2{}, 1, 2, func(codec types.Codec, data []byte) ([]byte, error) {
+		u := map[string]interface{}{}
+		if err := json.Unmarshal(data, &u); err != nil {
+			return nil, err
+		}
+		u["admin"] = u["last"] == "Admin"
+		return json.Marshal(u)
+	})
+}
+
+func TestStore_GetMigrated(t *testing.T) {
+	m := NewMock()
+	st, err := NewJSONStore(rewriteMock{m}, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewJSONStore must be nil")
+	assert.EqualValues(t, 2, schemaVersion(&userV2{}))
+
+	err = st.Put("users/1", userV1{"John Admin"}, nil)
+	assert.Nil(t, err, "Err in Put must be nil")
+	err = st.Put("users/2", userV1{"Jane Doe"}, nil)
+	assert.Nil(t, err, "Err in Put must be nil")
+	raw := m.kv["users/1"]
+
+	u := userV2{}
+	err = st.Get("users/1", &u, nil)
+	assert.Nil(t, err, "Err in Get must be nil")
+	assert.Equal(t, userV2{"John", "Admin", true}, u)
+	assert.Equal(t, raw, m.kv["users/1"], "Value must not be written back")
+
+	users := []userV2{}
+	_, err = st.List("users", &users, nil)
+	assert.Nil(t, err, "Err in List must be nil")
+	assert.ElementsMatch(t, []userV2{{"John", "Admin", true}, {"Jane", "Doe", false}}, users)
+
+	st.SetMigrationWriteBack(true)
+	err = st.Get("users/1", &u, nil)
+	assert.Nil(t, err, "Err in Get must be nil")
+	_, h, err := st.decryptReader(bytes.NewReader(m.kv["users/1"]), st.key[:])
+	assert.Nil(t, err, "Err in decrypt must be nil")
+	assert.EqualValues(t, 2, h.schema, "Value must be written back with current schema")
+
+	old := userV1{}
+	err = st.Get("users/1", &old, nil)
+	assert.Equal(t, ErrSchemaVersion, err)
+}
+
+func TestRegisterMigrationPanics(t *testing.T) {
+	fn := func(codec types.Codec, data []byte) ([]byte, error) { return data, nil }
+	assert.Panics(t, func() { RegisterMigration(userV2{}, 2, 2, fn) })
+	assert.Panics(t, func() { RegisterMigration(userV2{}, 1, 3, fn) })
+	assert.Panics(t, func() { RegisterMigration(userV2{}, 5, 6, nil) })
+}
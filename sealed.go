@@ -0,0 +1,124 @@
+package svalkey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"github.com/abronan/valkeyrie/store"
+	"github.com/karantin2020/svalkey/types"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+var (
+	// ErrWriteOnly represents read of write-only Store error
+	ErrWriteOnly = fmt.Errorf("svalkey: in Get" +
+		" Store is write-only")
+	// ErrNoPrivateKey represents read of sealed value
+	// by Store without private key error
+	ErrNoPrivateKey = fmt.Errorf("svalkey: in Get" +
+		" value is sealed and Store has no private key")
+)
+
+// sealInfo is HKDF info of sealed value keys
+const sealInfo = "svalkey sealed value"
+
+// GenerateSealKeys creates X25519 key pair for sealed values
+func GenerateSealKeys() (public, private [32]byte, err error) {
+	if _, err = io.ReadFull(rand.Reader, private[:]); err != nil {
+		return public, private, fmt.Errorf("svalkey: error generate private key; %s", err.Error())
+	}
+	pub, err := curve25519.X25519(private[:], curve25519.Basepoint)
+	if err != nil {
+		return public, private, err
+	}
+	copy(public[:], pub)
+	return public, private, nil
+}
+
+// NewSealedStore creates write-only Store which seals values to
+// X25519 public key of recipient. Every value is encrypted with
+// a key agreed between a random ephemeral key and recipient key,
+// so the Store can't read values, including its own ones:
+// reads of values return ErrWriteOnly. Readers open sealed values
+// with Store having the private key, see SetPrivateKey.
+// Sealed values are never chunked.
+//
+// The Store key, which hashes audit keys and derives keys of
+// scoped Stores, is random, so audit key hashes of sealed Store
+// don't match between processes
+func NewSealedStore(vstore store.Store, codec types.Codec,
+	cipherSuites []byte, recipient [32]byte) (*Store, error) {
+	var key [32]byte
+	if _, err := io.ReadFull(rand.Reader, key[:]); err != nil {
+		return nil, fmt.Errorf("svalkey: error generate sealed Store key; %s", err.Error())
+	}
+	s, err := NewCustomStore(vstore, codec, cipherSuites, key)
+	if err != nil {
+		return nil, err
+	}
+	s.recipient = &recipient
+	return s, nil
+}
+
+// SetPrivateKey sets X25519 private key used to open sealed values.
+// Values put by s are still encrypted with the Store key
+// unless s is created with NewSealedStore. The key is copied
+// into locked memory like the Store key and zeroed by Close
+func (s *Store) SetPrivateKey(private [32]byte) {
+	s.privBuf = newKeyBuffer(&private)
+	s.private = s.privBuf.key
+}
+
+// writeOnly reports if s can't read values
+func (s *Store) writeOnly() bool {
+	return s.recipient != nil && s.private == nil
+}
+
+// sealKey derives the key of sealed value from shared secret
+// of ephemeral and recipient keys
+func sealKey(shared, ephemeral, recipient []byte) ([]byte, error) {
+	salt := append(append([]byte{}, ephemeral...), recipient...)
+	key := make([]byte, 32)
+	kdf := hkdf.New(sha256.New, shared, salt, []byte(sealInfo))
+	if _, err := io.ReadFull(kdf, key); err != nil {
+		return nil, fmt.Errorf("svalkey: error key derivation, no key was derived")
+	}
+	return key, nil
+}
+
+// seal generates ephemeral key, puts its public part into h
+// and returns the key of the value
+func (s *Store) seal(h *header) ([]byte, error) {
+	public, private, err := GenerateSealKeys()
+	defer zeroBytes(private[:])
+	if err != nil {
+		return nil, err
+	}
+	shared, err := curve25519.X25519(private[:], s.recipient[:])
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(shared)
+	h.ephemeral = public[:]
+	return sealKey(shared, public[:], s.recipient[:])
+}
+
+// open returns the key of sealed value with header h
+func (s *Store) open(h *header) ([]byte, error) {
+	if s.private == nil {
+		return nil, ErrNoPrivateKey
+	}
+	shared, err := curve25519.X25519(s.private[:], h.ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(shared)
+	recipient, err := curve25519.X25519(s.private[:], curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	return sealKey(shared, h.ephemeral, recipient)
+}
@@ -0,0 +1,65 @@
+package svalkey
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore_Sealed(t *testing.T) {
+	m := NewMock()
+	pub, priv, err := GenerateSealKeys()
+	assert.Nil(t, err, "Err in GenerateSealKeys must be nil")
+	w, err := NewSealedStore(m, JSONCodec{}, []byte{1, 0}, pub)
+	assert.Nil(t, err, "Err in NewSealedStore must be nil")
+	w.SetChunkSize(64)
+
+	v := TestType{C: "sealed secret value which is longer than chunk size of the Store"}
+	assert.Nil(t, w.Put("a", v, nil), "Err in Put must be nil")
+	assert.Nil(t, w.PutBytes("b", []byte("raw"), nil), "Err in PutBytes must be nil")
+	assert.Nil(t, w.PutMany(map[string]interface{}{"c": v}, nil), "Err in PutMany must be nil")
+	assert.False(t, isManifest(m.kv["a"]), "Sealed value must not be chunked")
+
+	out := TestType{}
+	assert.Equal(t, ErrWriteOnly, w.Get("a", &out, nil), "Write-only Get must fail")
+	_, err = w.GetBytes("b", nil)
+	assert.Equal(t, ErrWriteOnly, err, "Write-only GetBytes must fail")
+	_, err = w.List("", &[]TestType{}, nil)
+	assert.Equal(t, ErrWriteOnly, err, "Write-only List must fail")
+	ok, err := w.Exists("a", nil)
+	assert.Nil(t, err, "Err in Exists must be nil")
+	assert.True(t, ok, "Exists must succeed on write-only Store")
+	assert.NotEqual(t, [32]byte{}, *w.key, "Sealed Store key must not be zero")
+	w2, err := NewSealedStore(m, JSONCodec{}, []byte{1, 0}, pub)
+	assert.Nil(t, err, "Err in NewSealedStore must be nil")
+	assert.NotEqual(t, w.AuditKey("a"), w2.AuditKey("a"),
+		"Sealed Stores must hash audit keys with their own random key")
+
+	// symmetric Store with private key opens sealed values
+	r, err := NewCustomStore(m, JSONCodec{}, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	assert.Equal(t, ErrNoPrivateKey, r.Get("a", &out, nil),
+		"Get of sealed value without private key must fail")
+	r.SetPrivateKey(priv)
+	assert.Nil(t, r.Get("a", &out, nil), "Err in Get must be nil")
+	assert.Equal(t, v, out, "Get must return sealed value")
+	data, err := r.GetBytes("b", nil)
+	assert.Nil(t, err, "Err in GetBytes must be nil")
+	assert.Equal(t, []byte("raw"), data, "GetBytes must return sealed value")
+	assert.Nil(t, r.Put("d", v, nil), "Err in Put must be nil")
+	assert.Nil(t, r.Get("d", &out, nil), "Err in Get must be nil")
+
+	// other private key
+	_, other, err := GenerateSealKeys()
+	assert.Nil(t, err, "Err in GenerateSealKeys must be nil")
+	r.SetPrivateKey(other)
+	assert.Equal(t, ErrAuthentication, r.Get("a", &out, nil),
+		"Get with other private key must fail authentication")
+
+	// header with ephemeral key is authenticated
+	r.SetPrivateKey(priv)
+	data = append([]byte{}, m.kv["a"]...)
+	data[len(envelopeMagic)+2+2] ^= 1
+	m.kv["a"] = data
+	assert.NotNil(t, r.Get("a", &out, nil), "Get of modified ephemeral key must fail")
+}
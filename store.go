@@ -2,25 +2,64 @@ package svalkey
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"reflect"
 	"sync"
+	"time"
 
 	"github.com/abronan/valkeyrie/store"
 	"github.com/karantin2020/svalkey/types"
 	"github.com/minio/sio"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/crypto/hkdf"
 )
 
 // Store holds data to work with backend db
 type Store struct {
-	Store        store.Store
-	codec        types.Codec
-	key          [32]byte
+	Store store.Store
+	codec types.Codec
+	// key points into keyBuf, which holds it in locked memory
+	key          *[32]byte
+	keyBuf       *keyBuffer
 	cipherSuites []byte
+	chunkSize    int
+	// chunked is set once chunking is enabled, puts and
+	// deletes look up chunks of replaced values then
+	chunked     bool
+	listWorkers int
+
+	migrateWriteBack bool
+	primers          *primerCache
+	metrics          Metrics
+	tracer           trace.Tracer
+	auditor          *auditor
+	interceptors     []Interceptor
+	retry            *RetryPolicy
+	policy           *Policy
+	// prefix is the namespace of scoped Store
+	prefix string
+	// borrowed is set if Store.Store belongs to the Store
+	// s was scoped from, so Close of s doesn't close it
+	borrowed bool
+	// recipient is public key values are sealed to
+	// and private is the key to open sealed values,
+	// it points into privBuf
+	recipient *[32]byte
+	private   *[32]byte
+	privBuf   *keyBuffer
+	// recipients are readers of values besides s
+	recipients []Recipient
+	// ctx is the parent of spans, set by WithContext
+	ctx context.Context
+	// changes is shared by copies of Store, so caches see
+	// writes done through any of them
+	changes *changeFeed
 }
 
 // ListPair holds return of List store method
@@ -29,6 +68,16 @@ type ListPair struct {
 	value interface{}
 }
 
+// Key returns key of the listed value
+func (p *ListPair) Key() string {
+	return p.key
+}
+
+// Value returns decoded listed value
+func (p *ListPair) Value() interface{} {
+	return p.value
+}
+
 var pool = &sync.Pool{
 	New: func() interface{} { return bytes.NewBuffer(nil) },
 }
@@ -52,6 +101,10 @@ var (
 	// ErrorInvalidOutSlice represents invalid out var type error
 	ErrorInvalidOutSlice = fmt.Errorf("svalkey: in List" +
 		" unmarshal value is not pointer to slice type")
+	// ErrAuthentication represents value authentication error: the value
+	// was encrypted with other key or modified
+	ErrAuthentication = fmt.Errorf("svalkey: in Get" +
+		" value failed authentication")
 )
 
 // NewCustomStore creates new *Store with custom underlying codec
@@ -66,11 +119,16 @@ func NewCustomStore(vstore store.Store,
 	if cipherSuites == nil || len(cipherSuites) == 0 {
 		return nil, ErrCipherSuites
 	}
+	keyBuf := newKeyBuffer(&key)
 	return &Store{
 		Store:        vstore,
 		codec:        codec,
-		key:          key,
+		key:          keyBuf.key,
+		keyBuf:       keyBuf,
 		cipherSuites: cipherSuites,
+		primers:      newPrimerCache(),
+		changes:      &changeFeed{},
+		metrics:      NopMetrics{},
 	}, nil
 }
 
@@ -98,12 +156,30 @@ func NewStore(vstore store.Store,
 		cipherSuites, key)
 }
 
-// Close closes Store.Store connection, frees resources
+// Close waits for running operations, zeroes the key, private
+// key and keys of recipients and closes Store.Store connection.
+// Operations started after Close return ErrStoreClosed.
+// Close of closed Store does nothing. Close of Store returned
+// by Scoped zeroes only its keys, the connection stays open
+// for the parent Store
 func (s *Store) Close() {
-	s.Store.Close()
-	for i := range s.key {
-		s.key[i] = 0
+	if !s.keyBuf.destroy() {
+		return
+	}
+	if s.privBuf != nil {
+		s.privBuf.destroy()
 	}
+	destroyRecipients(s.recipients)
+	if !s.borrowed {
+		s.Store.Close()
+	}
+}
+
+// KeyLocked reports if the key is held in memory locked in RAM
+// and guarded from overflow. It is false on platforms without
+// memory locking or if the memory lock limit is exceeded
+func (s *Store) KeyLocked() bool {
+	return s.keyBuf.locked()
 }
 
 // SetCodec sets new Codec to Store
@@ -116,19 +192,83 @@ func (s *Store) SetCipherSuites(cipherSuites []byte) {
 	s.cipherSuites = cipherSuites
 }
 
+// SetListWorkers sets the number of values List decodes
+// concurrently. Values are decoded sequentially if n is less than 2
+func (s *Store) SetListWorkers(n int) {
+	s.listWorkers = n
+}
+
 // Put a value at the specified key
 func (s *Store) Put(key string, value interface{},
 	options *store.WriteOptions) error {
-	val, err := s.encode(value, s.cipherSuites, s.key[:])
+	return s.run(&Operation{Name: OpPut, Key: key, Value: value,
+		WriteOptions: options}, s.handlePut)
+}
+
+func (s *Store) handlePut(op *Operation) error {
+	_, span := s.startSpan(op.Context, "svalkey.encode")
+	val, err := s.encode(op.Value, s.cipherSuites, s.key[:])
+	span.SetAttributes(valueSize(len(val)))
+	endSpan(span, err)
 	if err != nil {
 		return err
 	}
-	return s.Store.Put(key, val, options)
+	return s.put(op.Key, val, op.WriteOptions)
+}
+
+// put writes encoded value to backend store splitting it
+// into chunks if needed
+func (s *Store) put(key string, val []byte,
+	options *store.WriteOptions) error {
+	defer s.changes.changed(key)
+	s.metrics.ObserveValueSize("write", len(val))
+	if s.chunking() && len(val) > s.chunkSize {
+		return s.putChunked(key, val, options)
+	}
+	old, err := s.storedManifest(key)
+	if err != nil {
+		return err
+	}
+	err = s.backend("put", false, func() error {
+		return s.Store.Put(key, val, options)
+	})
+	if err != nil {
+		return err
+	}
+	return s.deleteChunks(key, old, nil)
+}
+
+// get reads encoded value from backend store reassembling
+// it from chunks if needed
+func (s *Store) get(key string, options *store.ReadOptions) (data []byte, err error) {
+	defer func() {
+		if err == nil {
+			s.metrics.ObserveValueSize("read", len(data))
+		}
+	}()
+	var pair *store.KVPair
+	err = s.backend("get", true, func() (err error) {
+		pair, err = s.Store.Get(key, options)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if isManifest(pair.Value) {
+		return s.readChunks(key, pair.Value, options)
+	}
+	return pair.Value, nil
 }
 
 // Get a value given its key
 func (s *Store) Get(key string, value interface{},
 	options *store.ReadOptions) error {
+	return s.run(&Operation{Name: OpGet, Key: key, Value: value,
+		ReadOptions: options}, s.handleGet)
+}
+
+// checkValue checks that value can be decoded into
+func checkValue(value interface{}) error {
 	if value == nil {
 		return ErrorNilValue
 	}
@@ -136,72 +276,233 @@ func (s *Store) Get(key string, value interface{},
 	if rv.Kind() != reflect.Ptr || rv.IsNil() {
 		return ErrorInvalidUnmarshal
 	}
-	pair, err := s.Store.Get(key, options)
+	return nil
+}
+
+func (s *Store) handleGet(op *Operation) error {
+	if err := checkValue(op.Value); err != nil {
+		return err
+	}
+	data, err := s.get(op.Key, op.ReadOptions)
 	if err != nil {
 		return err
 	}
-	// pair.Value, err = s.crypter.Decrypt(pair.Value)
-	// if err != nil {
-	// 	return err
-	// }
-	err = s.decode(pair.Value, value, s.cipherSuites, s.key[:])
+	_, span := s.startSpan(op.Context, "svalkey.decode", valueSize(len(data)))
+	upgraded, err := s.decode(data, op.Value, s.cipherSuites, s.key[:])
+	endSpan(span, err)
 	if err != nil {
 		return err
 	}
+	if upgraded && s.migrateWriteBack {
+		return s.writeBack(op.Context, op.Key, op.Value)
+	}
+	return nil
+}
+
+// PutBytes puts value at the specified key encrypting
+// it verbatim, without codec framing
+func (s *Store) PutBytes(key string, value []byte,
+	options *store.WriteOptions) error {
+	return s.PutStream(key, bytes.NewReader(value), options)
+}
+
+// GetBytes gets a value put with PutBytes or PutStream
+func (s *Store) GetBytes(key string,
+	options *store.ReadOptions) ([]byte, error) {
+	op := &Operation{Name: OpGetBytes, Key: key, ReadOptions: options}
+	if err := s.run(op, s.handleGetBytes); err != nil {
+		return nil, err
+	}
+	value, _ := op.Result.([]byte)
+	return value, nil
+}
+
+func (s *Store) handleGetBytes(op *Operation) error {
+	data, err := s.get(op.Key, op.ReadOptions)
+	if err != nil {
+		return err
+	}
+	decrypted, _, err := s.decryptReader(bytes.NewReader(data), s.key[:])
+	if err != nil {
+		return err
+	}
+	value, err := ioutil.ReadAll(decrypted)
+	if err != nil {
+		return s.decodeError("error decode value", err)
+	}
+	op.Result = value
 	return nil
 }
 
-// Delete the value at the specified key
+// Delete the value at the specified key. Chunks
+// of chunked value are deleted too
 func (s *Store) Delete(key string) error {
-	return s.Store.Delete(key)
+	return s.run(&Operation{Name: OpDelete, Key: key}, func(op *Operation) error {
+		return s.delete(op.Key)
+	})
+}
+
+func (s *Store) delete(key string) (err error) {
+	defer s.changes.changed(key)
+	old, err := s.storedManifest(key)
+	if err != nil {
+		return err
+	}
+	retried := false
+	err = s.backend("delete", true, func() error {
+		err := s.Store.Delete(key)
+		// delete which timed out may have been applied
+		if err == store.ErrKeyNotFound && retried {
+			return nil
+		}
+		retried = true
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return s.deleteChunks(key, old, nil)
 }
 
 // Exists verifies if a Key exists in the store
 func (s *Store) Exists(key string, options *store.ReadOptions) (bool, error) {
-	return s.Store.Exists(key, options)
+	op := &Operation{Name: OpExists, Key: key, ReadOptions: options}
+	err := s.run(op, func(op *Operation) (err error) {
+		op.Result, err = s.exists(op.Key, op.ReadOptions)
+		return err
+	})
+	ok, _ := op.Result.(bool)
+	return ok, err
 }
 
-// List the content of a given prefix
+func (s *Store) exists(key string, options *store.ReadOptions) (ok bool, err error) {
+	err = s.backend("exists", true, func() (err error) {
+		ok, err = s.Store.Exists(key, options)
+		return err
+	})
+	return ok, err
+}
+
+// List the content of a given prefix. With Policy set
+// values not readable by the identity are left out
 func (s *Store) List(directory string, value interface{},
 	options *store.ReadOptions) ([]*ListPair, error) {
+	op := &Operation{Name: OpList, Key: directory, Value: value,
+		ReadOptions: options}
+	if err := s.run(op, s.handleList); err != nil {
+		return nil, err
+	}
+	pairs, _ := op.Result.([]*ListPair)
+	return pairs, nil
+}
+
+func (s *Store) handleList(op *Operation) error {
 	retList := []*ListPair{}
-	lres, err := s.Store.List(directory, options)
+	lres, err := s.list(op.Key, op.ReadOptions)
 	if err != nil {
 		if err == store.ErrKeyNotFound {
-			return retList, nil
+			op.Result = retList
+			return nil
 		}
-		return nil, err
+		return err
 	}
-	v := reflect.ValueOf(value)
+	v := reflect.ValueOf(op.Value)
 	if v.Kind() != reflect.Ptr {
-		return nil, ErrorInvalidOutPointer
+		return ErrorInvalidOutPointer
 	}
 	// get the value that the pointer v points to.
 	slice := v.Elem()
 	if slice.Kind() != reflect.Slice {
-		return nil, ErrorInvalidOutSlice
+		return ErrorInvalidOutSlice
 	}
+	lres = filterInternal(lres)
+	readable := lres[:0]
+	for _, p := range lres {
+		if s.readable(op.Context, p.Key) {
+			readable = append(readable, p)
+		}
+	}
+	lres = readable
 	slice.Set(reflect.MakeSlice(slice.Type(), len(lres), len(lres)))
 
-	for i, val := range lres {
-		err := s.decode(val.Value,
+	upgraded := make([]bool, len(lres))
+	errs := make([]error, len(lres))
+	size := 0
+	for _, p := range lres {
+		size += len(p.Value)
+	}
+	_, span := s.startSpan(op.Context, "svalkey.decode", valueSize(size),
+		attribute.Int("svalkey.values", len(lres)))
+	parallel(len(lres), s.listWorkers, func(i int) {
+		data := lres[i].Value
+		if isManifest(data) {
+			data, errs[i] = s.readChunks(lres[i].Key, data, op.ReadOptions)
+			if errs[i] != nil {
+				return
+			}
+		}
+		upgraded[i], errs[i] = s.decode(data,
 			slice.Index(i).Addr().Interface(),
 			s.cipherSuites,
 			s.key[:])
+	})
+	// report the error of the first failed value
+	// regardless of decoding order
+	for _, err := range errs {
 		if err != nil {
-			return nil, err
+			endSpan(span, err)
+			return err
+		}
+	}
+	endSpan(span, nil)
+	for i, val := range lres {
+		if upgraded[i] && s.migrateWriteBack {
+			err = s.writeBack(op.Context, val.Key, slice.Index(i).Addr().Interface())
+			if err != nil {
+				return err
+			}
 		}
 		retList = append(retList, &ListPair{val.Key, slice.Index(i).Interface()})
 	}
-	return retList, nil
+	op.Result = retList
+	return nil
 }
 
-// DeleteTree deletes a range of keys under a given directory
+// list returns backend entries under directory
+func (s *Store) list(directory string, options *store.ReadOptions) ([]*store.KVPair, error) {
+	var pairs []*store.KVPair
+	err := s.backend("list", true, func() (err error) {
+		pairs, err = s.Store.List(directory, options)
+		return err
+	})
+	return pairs, err
+}
+
+// DeleteTree deletes a range of keys under a given directory.
+// Chunks of values are stored under their keys, so
+// they are deleted too
 func (s *Store) DeleteTree(directory string) error {
-	return s.Store.DeleteTree(directory)
+	return s.run(&Operation{Name: OpDeleteTree, Key: directory}, func(op *Operation) error {
+		defer s.changes.changed("")
+		return s.backend("delete_tree", true, func() error {
+			return s.Store.DeleteTree(op.Key)
+		})
+	})
+}
+
+// filterInternal removes chunk and reserved entries
+// from backend List result
+func filterInternal(pairs []*store.KVPair) []*store.KVPair {
+	ret := pairs[:0]
+	for _, p := range pairs {
+		if !isChunkKey(p.Key) && !isReservedKey(p.Key) {
+			ret = append(ret, p)
+		}
+	}
+	return ret
 }
 
-func deriveKey(masterkey []byte) ([]byte, []byte, error) {
+func deriveKey(masterkey, info []byte) ([]byte, []byte, error) {
 	var nonce [32]byte
 	if n, err := io.ReadFull(rand.Reader, nonce[:]); err != nil || n != 32 {
 		return nil, nil, fmt.Errorf("svalkey: error key derivation, no nonce was got")
@@ -209,31 +510,42 @@ func deriveKey(masterkey []byte) ([]byte, []byte, error) {
 
 	// derive an encryption key from the master key and the nonce
 	var key [32]byte
-	kdf := hkdf.New(sha256.New, masterkey, nonce[:], nil)
+	kdf := hkdf.New(sha256.New, masterkey, nonce[:], info)
 	if n, err := io.ReadFull(kdf, key[:]); err != nil || n != 32 {
 		return nil, nil, fmt.Errorf("svalkey: error key derivation, no key was derived")
 	}
 	return key[:], nonce[:], nil
 }
 
+// subKey derives a key for the purpose described by info
+// from the Store key
+func (s *Store) subKey(info string) []byte {
+	key := make([]byte, 32)
+	kdf := hkdf.New(sha256.New, s.key[:], nil, []byte(info))
+	io.ReadFull(kdf, key)
+	return key
+}
+
 func (s *Store) encode(val interface{}, cs []byte, key []byte) (data []byte, err error) {
+	defer func(start time.Time) {
+		s.metrics.ObserveCodec("encode", time.Since(start), err)
+	}(time.Now())
 	buf := pool.Get().(*bytes.Buffer)
 	defer func() {
 		zeroBytes(buf.Bytes())
 		buf.Reset()
 		pool.Put(buf)
 	}()
-	dkey, nonce, err := deriveKey(key)
-	if err != nil {
-		return nil, err
-	}
-	n, err := buf.Write(nonce)
-	if err != nil || n != 32 {
-		return nil, fmt.Errorf("svalkey: error prefix nonce in value; %s", err.Error())
+	h := &header{schema: schemaVersion(val)}
+	if p := primerOf(s.codec); p != nil {
+		if err = s.savePrimer(p); err != nil {
+			return nil, err
+		}
+		h.primer = p.id
 	}
-	encrypted, err := sio.EncryptWriter(buf, sio.Config{Key: dkey})
+	encrypted, err := s.encryptWriter(buf, key, h)
 	if err != nil {
-		return nil, fmt.Errorf("svalkey: failed to make encrypt writer; %s", err.Error())
+		return nil, err
 	}
 	enc := s.codec.NewEncoder(encrypted)
 	if pCodec, ok := s.codec.(*pooledCodec); ok && err == nil {
@@ -243,37 +555,168 @@ func (s *Store) encode(val interface{}, cs []byte, key []byte) (data []byte, err
 	if err != nil {
 		return nil, fmt.Errorf("svalkey: error value encode; %s", err.Error())
 	}
-	encrypted.Close()
+	if err = encrypted.Close(); err != nil {
+		return nil, fmt.Errorf("svalkey: error value encrypt; %s", err.Error())
+	}
 	data = append(data, buf.Bytes()...)
 
 	return data, err
 }
 
-func (s *Store) decode(data []byte, val interface{}, cs []byte, key []byte) (err error) {
-	buf := bytes.NewReader(data)
+// encryptWriter prefixes w with the envelope header and the value
+// nonce and returns writer which encrypts data with the key derived
+// from nonce and header. Close must be called to flush the last
+// encrypted package
+func (s *Store) encryptWriter(w io.Writer, key []byte,
+	h *header) (io.WriteCloser, error) {
+	h.ephemeral, h.recipients = nil, nil
+	if len(s.recipients) > 0 {
+		dek, err := s.wrapDEK(h)
+		if err != nil {
+			return nil, err
+		}
+		defer zeroBytes(dek)
+		key = dek
+	} else if s.recipient != nil {
+		skey, err := s.seal(h)
+		if err != nil {
+			return nil, err
+		}
+		defer zeroBytes(skey)
+		key = skey
+	}
+	info, err := writeHeader(w, h)
+	if err != nil {
+		return nil, fmt.Errorf("svalkey: error write envelope header; %s", err.Error())
+	}
+	dkey, nonce, err := deriveKey(key, info)
+	if err != nil {
+		return nil, err
+	}
+	// the cipher is set up by EncryptWriter, so dkey is not used later
+	defer zeroBytes(dkey)
+	n, err := w.Write(nonce)
+	if err != nil || n != 32 {
+		return nil, fmt.Errorf("svalkey: error prefix nonce in value; %v", err)
+	}
+	encrypted, err := sio.EncryptWriter(w, sio.Config{Key: dkey})
+	if err != nil {
+		return nil, fmt.Errorf("svalkey: failed to make encrypt writer; %s", err.Error())
+	}
+	return encrypted, nil
+}
+
+// decryptReader reads the envelope header and the value nonce
+// from r and returns reader which decrypts and authenticates
+// the rest of r
+func (s *Store) decryptReader(r io.Reader, key []byte) (io.Reader, *header, error) {
+	h, info, r, err := readHeader(r)
+	if err != nil {
+		return nil, nil, err
+	}
 	var nonce [32]byte
-	n, err := buf.Read(nonce[:])
+	n, err := io.ReadFull(r, nonce[:])
 	if err != nil || n != 32 {
-		return fmt.Errorf("svalkey: error read nonce from db value")
+		return nil, nil, fmt.Errorf("svalkey: error read nonce from db value")
+	}
+	if h.recipients != nil {
+		dek, err := s.unwrap(h.recipients)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer zeroBytes(dek)
+		key = dek
+	} else if h.ephemeral != nil {
+		skey, err := s.open(h)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer zeroBytes(skey)
+		key = skey
 	}
 	var dkey [32]byte
-	kdf := hkdf.New(sha256.New, key, nonce[:], nil)
+	defer zeroBytes(dkey[:])
+	kdf := hkdf.New(sha256.New, key, nonce[:], info)
 	if n, err := io.ReadFull(kdf, dkey[:]); err != nil || n != 32 {
-		return fmt.Errorf("svalkey: error key derivation, no key was derived")
+		return nil, nil, fmt.Errorf("svalkey: error key derivation, no key was derived")
 	}
-	decrypted, err := sio.DecryptReader(buf, sio.Config{Key: dkey[:]})
+	// values are always written with DARE 2.0, pinning the version
+	// makes DecryptReader set up the cipher now instead of on the
+	// first Read, so dkey is not used later
+	decrypted, err := sio.DecryptReader(r, sio.Config{Key: dkey[:],
+		MinVersion: sio.Version20, MaxVersion: sio.Version20})
 	if err != nil {
-		return fmt.Errorf("svalkey: error decode value; %s", err.Error())
+		return nil, nil, fmt.Errorf("svalkey: error decode value; %s", err.Error())
 	}
-	dec := s.codec.NewDecoder(decrypted)
-	if pCodec, ok := s.codec.(*pooledCodec); ok && err == nil {
+	return decrypted, h, nil
+}
+
+// decode decrypts data and decodes it into val upgrading it
+// to the current schema version. It reports whether
+// the value was upgraded
+func (s *Store) decode(data []byte, val interface{}, cs []byte,
+	key []byte) (upgraded bool, err error) {
+	decrypted, h, err := s.decryptReader(bytes.NewReader(data), key)
+	if err != nil {
+		return false, err
+	}
+	return s.decodePlain(decrypted, h, val)
+}
+
+// decodePlain decodes decrypted value with envelope header h
+// into val upgrading it to the current schema version
+func (s *Store) decodePlain(decrypted io.Reader, h *header,
+	val interface{}) (upgraded bool, err error) {
+	defer func(start time.Time) {
+		s.metrics.ObserveCodec("decode", time.Since(start), err)
+	}(time.Now())
+	codec, err := s.codecFor(h)
+	if err != nil {
+		return false, err
+	}
+	if h.schema != schemaVersion(val) {
+		plain, err := ioutil.ReadAll(decrypted)
+		if err != nil {
+			return false, s.decodeError("error decode value", err)
+		}
+		defer zeroBytes(plain)
+		plain, err = migrate(codec, val, h.schema, plain)
+		if err != nil {
+			return false, err
+		}
+		decrypted = bytes.NewReader(plain)
+		upgraded = true
+	}
+	dec := codec.NewDecoder(decrypted)
+	if pCodec, ok := codec.(*pooledCodec); ok && err == nil {
 		defer pCodec.PutDecoder(dec)
 	}
 	err = dec.Decode(val)
 	if err != nil {
-		return fmt.Errorf("svalkey: error decode key; %s", err.Error())
+		return false, s.decodeError("error decode key", err)
 	}
-	return err
+	return upgraded, err
+}
+
+// decodeError returns ErrAuthentication for authentication
+// failure and counts it, other errors are prefixed with msg
+func (s *Store) decodeError(msg string, err error) error {
+	if isAuthError(err) {
+		s.metrics.IncAuthFailures()
+		return ErrAuthentication
+	}
+	return fmt.Errorf("svalkey: %s; %s", msg, err.Error())
+}
+
+// writeBack puts value upgraded to the current schema version.
+// It is part of the read operation authorized by ctx, so it
+// doesn't go through interceptors and policy
+func (s *Store) writeBack(ctx context.Context, key string, value interface{}) error {
+	err := s.handlePut(&Operation{Context: ctx, Name: OpPut, Key: key, Value: value})
+	if err != nil {
+		return fmt.Errorf("svalkey: error migration write back; %s", err.Error())
+	}
+	return nil
 }
 
 func (s *Store) toBytes(key interface{}) (keyBytes []byte, err error) {
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"sort"
 	"testing"
 	"time"
 
@@ -336,3 +337,70 @@ func randString(r *rand.Rand) string {
 func randUint64(r *rand.Rand) uint64 {
 	return uint64(r.Uint32())<<32 | uint64(r.Uint32())
 }
+
+func TestStore_PutAndGetBytes(t *testing.T) {
+	m := newMockStore(t)
+
+	st, err := NewCustomStore(m, RawCodec{}, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+
+	pem := []byte("-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n")
+	err = st.PutBytes("pem", pem, nil)
+	assert.Nil(t, err, "Err in PutBytes must be nil")
+	out, err := st.GetBytes("pem", nil)
+	assert.Nil(t, err, "Err in GetBytes must be nil")
+	assert.Equal(t, pem, out, "Result PutBytes->GetBytes value must be equal")
+
+	// RawCodec and PutBytes share the same value format
+	token := ""
+	err = st.Put("token", "secret token", nil)
+	assert.Nil(t, err, "Err in Put must be nil")
+	err = st.Get("token", &token, nil)
+	assert.Nil(t, err, "Err in Get must be nil")
+	assert.Equal(t, "secret token", token)
+	out, err = st.GetBytes("token", nil)
+	assert.Nil(t, err, "Err in GetBytes must be nil")
+	assert.Equal(t, []byte("secret token"), out)
+
+	err = st.Put("int", 1, nil)
+	assert.NotNil(t, err, "Err in Put of unsupported type must not be nil")
+}
+
+// sortedMock lists keys in order like real backends do
+type sortedMock struct {
+	*Mock
+}
+
+func (m sortedMock) List(directory string,
+	options *store.ReadOptions) ([]*store.KVPair, error) {
+	pairs, err := m.Mock.List(directory, options)
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+	return pairs, err
+}
+
+func TestStore_ListParallel(t *testing.T) {
+	m := NewMock()
+	st, err := NewCustomStore(sortedMock{m}, JSONCodec{}, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	st.SetListWorkers(8)
+	for i := 0; i < 100; i++ {
+		k := fmt.Sprintf("k%03d", i)
+		assert.Nil(t, st.Put(k, TestType{C: k}, nil), "Err in Put must be nil")
+	}
+	list := []TestType{}
+	pairs, err := st.List("", &list, nil)
+	assert.Nil(t, err, "Err in List must be nil")
+	assert.Len(t, pairs, 100)
+	for i, p := range pairs {
+		assert.Equal(t, fmt.Sprintf("k%03d", i), p.Key())
+		assert.Equal(t, p.Key(), list[i].C, "Value must be decoded at its key index")
+	}
+
+	// The error of the first failed value is reported
+	m.kv["k010"] = []byte("short")
+	m.kv["k090"][len(m.kv["k090"])-1] ^= 0xff
+	for i := 0; i < 10; i++ {
+		_, err = st.List("", &list, nil)
+		assert.Equal(t, ErrEnvelope, err, "Err of the first failed value must be returned")
+	}
+}
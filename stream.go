@@ -0,0 +1,133 @@
+package svalkey
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/abronan/valkeyrie/store"
+)
+
+// streamReader reads decrypted stream of a value. It returns
+// ErrAuthentication if the value is not authentic. Close only stops
+// reading: the value is fetched already or chunks are fetched
+// on demand, so there is nothing to release
+type streamReader struct {
+	io.Reader
+	s *Store
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if isAuthError(err) {
+		r.s.metrics.IncAuthFailures()
+		r.Reader = errReader{ErrAuthentication}
+		err = ErrAuthentication
+	}
+	return n, err
+}
+
+func (r *streamReader) Close() error {
+	r.Reader = eofReader{}
+	return nil
+}
+
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+type eofReader struct{}
+
+func (eofReader) Read([]byte) (int, error) { return 0, io.EOF }
+
+// PutStream encrypts data read from r and puts it at the specified key.
+// Data is not passed through the codec. In chunking mode every chunk
+// is written to backend as soon as it is encrypted, so neither
+// plaintext nor ciphertext is held in memory as a whole. Without
+// chunking the whole ciphertext is held in memory before it is put,
+// set SetChunkSize to stream large values
+func (s *Store) PutStream(key string, r io.Reader,
+	options *store.WriteOptions) error {
+	return s.run(&Operation{Name: OpPutStream, Key: key, Reader: r,
+		WriteOptions: options}, s.handlePutStream)
+}
+
+func (s *Store) handlePutStream(op *Operation) error {
+	key, r, options := op.Key, op.Reader, op.WriteOptions
+	if s.chunking() {
+		w, err := s.newChunkWriter(key, options)
+		if err != nil {
+			return err
+		}
+		defer s.changes.changed(key)
+		if err := s.encryptStream(w, r); err != nil {
+			w.abort()
+			return err
+		}
+		return w.Close()
+	}
+	// backends may keep the value slice, so the buffer
+	// is not pooled and passed to backend without copy
+	buf := &bytes.Buffer{}
+	if err := s.encryptStream(buf, r); err != nil {
+		return err
+	}
+	return s.put(key, buf.Bytes(), options)
+}
+
+func (s *Store) encryptStream(w io.Writer, r io.Reader) error {
+	encrypted, err := s.encryptWriter(w, s.key[:], &header{})
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(encrypted, r); err != nil {
+		return fmt.Errorf("svalkey: error value encrypt; %s", err.Error())
+	}
+	if err = encrypted.Close(); err != nil {
+		return fmt.Errorf("svalkey: error value encrypt; %s", err.Error())
+	}
+	return nil
+}
+
+// GetStream returns reader which decrypts the value at the specified
+// key as it is read. Chunks of a chunked value are fetched and verified
+// on demand. Read returns ErrAuthentication if the value is not
+// authentic, so data must not be trusted until io.EOF is read
+func (s *Store) GetStream(key string,
+	options *store.ReadOptions) (io.ReadCloser, error) {
+	op := &Operation{Name: OpGetStream, Key: key, ReadOptions: options}
+	if err := s.run(op, s.handleGetStream); err != nil {
+		return nil, err
+	}
+	r, _ := op.Result.(io.ReadCloser)
+	return r, nil
+}
+
+func (s *Store) handleGetStream(op *Operation) error {
+	var pair *store.KVPair
+	err := s.backend("get", true, func() (err error) {
+		pair, err = s.Store.Get(op.Key, op.ReadOptions)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	var src io.Reader = bytes.NewReader(pair.Value)
+	size := len(pair.Value)
+	if isManifest(pair.Value) {
+		cr, err := s.newChunkReader(op.Key, pair.Value, op.ReadOptions)
+		if err != nil {
+			return err
+		}
+		src, size = cr, int(cr.m.size)
+	}
+	s.metrics.ObserveValueSize("read", size)
+	decrypted, _, err := s.decryptReader(src, s.key[:])
+	if err != nil {
+		return err
+	}
+	op.Result = &streamReader{Reader: decrypted, s: s}
+	return nil
+}
@@ -0,0 +1,62 @@
+package svalkey
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore_PutAndGetStream(t *testing.T) {
+	v := make([]byte, 200*1024)
+	rand.Read(v)
+
+	for _, chunkSize := range []int{0, 16 * 1024} {
+		st, m := newChunkedStore(t)
+		st.SetChunkSize(chunkSize)
+
+		err := st.PutStream("stream", bytes.NewReader(v), nil)
+		assert.Nil(t, err, "Err in PutStream must be nil")
+		assert.Equal(t, chunkSize > 0, isManifest(m.kv["stream"]),
+			"Value must be chunked only in chunking mode")
+
+		r, err := st.GetStream("stream", nil)
+		assert.Nil(t, err, "Err in GetStream must be nil")
+		out, err := ioutil.ReadAll(r)
+		assert.Nil(t, err, "Err in stream read must be nil")
+		assert.Nil(t, r.Close(), "Err in stream Close must be nil")
+		assert.Equal(t, v, out, "Result PutStream->GetStream value must be equal")
+	}
+}
+
+func TestStore_GetStreamTampered(t *testing.T) {
+	st, m := newChunkedStore(t)
+
+	v := bytes.Repeat([]byte("streamed secret "), 1000)
+	err := st.PutStream("stream", bytes.NewReader(v), nil)
+	assert.Nil(t, err, "Err in PutStream must be nil")
+
+	chunk := m.kv[storedChunkKey(st, "stream", 3)]
+	chunk[0] ^= 0xff
+	r, err := st.GetStream("stream", nil)
+	assert.Nil(t, err, "Err in GetStream must be nil")
+	_, err = ioutil.ReadAll(r)
+	assert.Equal(t, ErrChunkCorrupted, err)
+
+	assert.Nil(t, st.Delete("stream"), "Err in Delete must be nil")
+	assert.Empty(t, m.kv, "Delete must remove value and all chunks")
+	st.SetChunkSize(0)
+	metrics := newRecordMetrics()
+	st.SetMetrics(metrics)
+	assert.Nil(t, st.PutStream("stream", bytes.NewReader(v), nil),
+		"Err in PutStream must be nil")
+	val := m.kv["stream"]
+	val[len(val)-1] ^= 0xff
+	r, err = st.GetStream("stream", nil)
+	assert.Nil(t, err, "Err in GetStream must be nil")
+	_, err = ioutil.ReadAll(r)
+	assert.Equal(t, ErrAuthentication, err, "Read of tampered value must fail authentication")
+	assert.Equal(t, 1, metrics.auth, "Authentication failure must be counted")
+}
@@ -0,0 +1,106 @@
+package svalkey
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/minio/sio"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the OpenTelemetry instrumentation name of svalkey
+const tracerName = "github.com/karantin2020/svalkey"
+
+// SetTracerProvider enables OpenTelemetry tracing of Store operations
+// and their encode and decode stages. Spans hold backend, codec,
+// cipher suites and value sizes, never keys or values.
+// Nil tp disables tracing
+func (s *Store) SetTracerProvider(tp trace.TracerProvider) {
+	if tp == nil {
+		s.tracer = nil
+		return
+	}
+	s.tracer = tp.Tracer(tracerName)
+}
+
+// WithContext returns a copy of s which uses ctx as parent
+// of its spans. Valkeyrie backends don't accept context,
+// so ctx doesn't cancel backend calls
+func (s *Store) WithContext(ctx context.Context) *Store {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	c := *s
+	c.ctx = ctx
+	return &c
+}
+
+func (s *Store) context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// startSpan starts span name under ctx. If tracing is disabled
+// it returns non-recording span
+func (s *Store) startSpan(ctx context.Context, name string,
+	attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if s.tracer == nil {
+		return ctx, trace.SpanFromContext(context.Background())
+	}
+	return s.tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// startOperation starts span of Store operation op on keys and
+// returns function which ends it, reports the operation metrics
+// and audit records
+func (s *Store) startOperation(op string, keys ...string) (context.Context, func(error)) {
+	start := time.Now()
+	var attrs []attribute.KeyValue
+	if s.tracer != nil {
+		attrs = []attribute.KeyValue{
+			attribute.String("svalkey.backend", fmt.Sprintf("%T", s.Store)),
+			attribute.String("svalkey.codec", fmt.Sprintf("%T", s.codec)),
+			attribute.String("svalkey.cipher_suites", cipherSuiteNames(s.cipherSuites)),
+		}
+	}
+	ctx, span := s.startSpan(s.context(), "svalkey."+op, attrs...)
+	return ctx, func(err error) {
+		endSpan(span, err)
+		s.metrics.ObserveOperation(op, time.Since(start), err)
+		s.audit(start, op, keys, err)
+	}
+}
+
+func cipherSuiteNames(cs []byte) string {
+	names := make([]string, len(cs))
+	for i, c := range cs {
+		switch c {
+		case sio.AES_256_GCM:
+			names[i] = "AES-256-GCM"
+		case sio.CHACHA20_POLY1305:
+			names[i] = "CHACHA20-POLY1305"
+		default:
+			names[i] = fmt.Sprint(c)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// valueSize is the span attribute of encrypted value size
+func valueSize(n int) attribute.KeyValue {
+	return attribute.Int("svalkey.value_size", n)
+}
@@ -0,0 +1,69 @@
+package svalkey
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestStore_Tracing(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	st, err := NewCustomStore(NewMock(), JSONCodec{}, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	st.SetTracerProvider(tp)
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "load secrets")
+	cst := st.WithContext(ctx)
+	assert.Nil(t, cst.Put("a", TestType{C: "secret"}, nil), "Err in Put must be nil")
+	out := TestType{}
+	assert.Nil(t, cst.Get("a", &out, nil), "Err in Get must be nil")
+	list := []TestType{}
+	_, err = cst.List("", &list, nil)
+	assert.Nil(t, err, "Err in List must be nil")
+	assert.Nil(t, cst.Delete("a"), "Err in Delete must be nil")
+	assert.NotNil(t, cst.Get("a", &out, nil), "Err in Get must not be nil")
+	parent.End()
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	names := []string{}
+	for _, s := range sr.Ended() {
+		names = append(names, s.Name())
+		spans[s.Name()] = s
+		for _, a := range s.Attributes() {
+			assert.NotContains(t, a.Value.Emit(), "secret", "Span must not hold plaintext")
+		}
+	}
+	assert.Equal(t, []string{
+		"svalkey.encode", "svalkey.put",
+		"svalkey.decode", "svalkey.get",
+		"svalkey.decode", "svalkey.list",
+		"svalkey.delete", "svalkey.get", "load secrets",
+	}, names)
+
+	put := spans["svalkey.put"]
+	assert.Equal(t, parent.SpanContext().SpanID(), put.Parent().SpanID(),
+		"Operation span must be child of context span")
+	assert.Equal(t, put.SpanContext().SpanID(), spans["svalkey.encode"].Parent().SpanID(),
+		"Encode span must be child of operation span")
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, a := range put.Attributes() {
+		attrs[a.Key] = a.Value
+	}
+	assert.Equal(t, "*svalkey.Mock", attrs["svalkey.backend"].AsString())
+	assert.Equal(t, "svalkey.JSONCodec", attrs["svalkey.codec"].AsString())
+	assert.Equal(t, "CHACHA20-POLY1305,AES-256-GCM", attrs["svalkey.cipher_suites"].AsString())
+	assert.Equal(t, codes.Error, spans["svalkey.get"].Status().Code,
+		"Failed operation span must have error status")
+
+	// Tracing is disabled by nil provider
+	st.SetTracerProvider(nil)
+	n := len(sr.Ended())
+	assert.Nil(t, st.Put("a", TestType{C: "secret"}, nil), "Err in Put must be nil")
+	assert.Len(t, sr.Ended(), n, "No spans must be recorded")
+}
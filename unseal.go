@@ -0,0 +1,225 @@
+package svalkey
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/karantin2020/svalkey/crypto/shamir"
+)
+
+var (
+	// ErrKeyShare represents malformed or corrupted key share error
+	ErrKeyShare = fmt.Errorf("svalkey: in Unsealer" +
+		" key share is malformed or corrupted")
+	// ErrShareMismatch represents key share of other split error
+	ErrShareMismatch = fmt.Errorf("svalkey: in Unsealer" +
+		" key share belongs to other key or split")
+	// ErrUnseal represents key combined from shares
+	// failed integrity check error
+	ErrUnseal = fmt.Errorf("svalkey: in Unsealer" +
+		" combined key failed integrity check")
+	// ErrNoOpen represents Unsealer without open function error
+	ErrNoOpen = fmt.Errorf("svalkey: in Unsealer" +
+		" open function is nil")
+)
+
+// keySharePrefix prefixes encoded key shares
+const keySharePrefix = "svkshare1-"
+
+// Key share layout, encoded with base64 URL encoding:
+//
+//	threshold | x | y | key check | checksum
+//	    1       1   32      8           4
+//
+// Key check is HMAC-SHA256 of the key and identifies shares of
+// one key, it is verified after the key is combined. Checksum is
+// SHA-256 of the preceding bytes and detects corrupted shares
+const (
+	keyCheckSize = 8
+	checksumSize = 4
+	keyShareSize = 2 + 32 + keyCheckSize + checksumSize
+)
+
+type keyShare struct {
+	threshold int
+	x         byte
+	y         []byte
+	check     []byte
+}
+
+func keyCheck(key [32]byte) []byte {
+	mac := hmac.New(sha256.New, key[:])
+	mac.Write([]byte("svalkey unseal check"))
+	return mac.Sum(nil)[:keyCheckSize]
+}
+
+// SplitKey splits master key into n shares, any k of them
+// unseal it with Unsealer or CombineKeyShares
+func SplitKey(key [32]byte, n, k int) ([]string, error) {
+	shares, err := shamir.Split(key[:], n, k)
+	if err != nil {
+		return nil, err
+	}
+	check := keyCheck(key)
+	out := make([]string, n)
+	for i, s := range shares {
+		b := make([]byte, 0, keyShareSize)
+		b = append(b, byte(k), s[32])
+		b = append(b, s[:32]...)
+		b = append(b, check...)
+		sum := sha256.Sum256(b)
+		b = append(b, sum[:checksumSize]...)
+		out[i] = keySharePrefix + base64.RawURLEncoding.EncodeToString(b)
+		zeroBytes(s)
+		zeroBytes(b)
+	}
+	return out, nil
+}
+
+func parseKeyShare(share string) (*keyShare, error) {
+	share = strings.TrimSpace(share)
+	if !strings.HasPrefix(share, keySharePrefix) {
+		return nil, ErrKeyShare
+	}
+	b, err := base64.RawURLEncoding.DecodeString(share[len(keySharePrefix):])
+	if err != nil || len(b) != keyShareSize {
+		return nil, ErrKeyShare
+	}
+	sum := sha256.Sum256(b[:keyShareSize-checksumSize])
+	if !bytes.Equal(sum[:checksumSize], b[keyShareSize-checksumSize:]) ||
+		b[0] < 2 || b[1] == 0 {
+		return nil, ErrKeyShare
+	}
+	return &keyShare{
+		threshold: int(b[0]),
+		x:         b[1],
+		y:         b[2:34],
+		check:     b[34 : 34+keyCheckSize],
+	}, nil
+}
+
+// CombineKeyShares combines master key from threshold or more shares
+func CombineKeyShares(shares []string) (key [32]byte, err error) {
+	u := &Unsealer{}
+	for _, s := range shares {
+		if err = u.add(s); err != nil {
+			return key, err
+		}
+	}
+	return u.combine()
+}
+
+// Unsealer accepts key shares one by one and opens Store
+// with the master key combined from them once threshold
+// shares are added. It is safe for concurrent use
+type Unsealer struct {
+	mu     sync.Mutex
+	open   func(key [32]byte) (*Store, error)
+	first  *keyShare
+	shares map[byte]*keyShare
+}
+
+// NewUnsealer creates Unsealer which opens Store with open.
+// It returns ErrNoOpen if open is nil
+func NewUnsealer(open func(key [32]byte) (*Store, error)) (*Unsealer, error) {
+	if open == nil {
+		return nil, ErrNoOpen
+	}
+	return &Unsealer{open: open}, nil
+}
+
+// Add adds key share. It returns Store opened with the combined
+// key when threshold shares are added and nil Store before.
+// Shares are dropped after the key is combined, successfully or not.
+// Unsealer not created with NewUnsealer returns ErrNoOpen
+func (u *Unsealer) Add(share string) (*Store, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.open == nil {
+		return nil, ErrNoOpen
+	}
+	if err := u.add(share); err != nil {
+		return nil, err
+	}
+	if len(u.shares) < u.first.threshold {
+		return nil, nil
+	}
+	key, err := u.combine()
+	u.reset()
+	defer zeroBytes(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return u.open(key)
+}
+
+// Progress returns the number of added shares and the threshold,
+// which is zero before the first share is added
+func (u *Unsealer) Progress() (added, threshold int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.first == nil {
+		return 0, 0
+	}
+	return len(u.shares), u.first.threshold
+}
+
+// Reset drops added shares
+func (u *Unsealer) Reset() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.reset()
+}
+
+func (u *Unsealer) reset() {
+	for _, s := range u.shares {
+		zeroBytes(s.y)
+	}
+	u.first, u.shares = nil, nil
+}
+
+func (u *Unsealer) add(share string) error {
+	s, err := parseKeyShare(share)
+	if err != nil {
+		return err
+	}
+	if u.first == nil {
+		u.first = s
+		u.shares = map[byte]*keyShare{}
+	}
+	if s.threshold != u.first.threshold || !bytes.Equal(s.check, u.first.check) {
+		zeroBytes(s.y)
+		return ErrShareMismatch
+	}
+	u.shares[s.x] = s
+	return nil
+}
+
+func (u *Unsealer) combine() (key [32]byte, err error) {
+	if u.first == nil || len(u.shares) < u.first.threshold {
+		return key, ErrUnseal
+	}
+	shares := make([][]byte, 0, len(u.shares))
+	for x, s := range u.shares {
+		shares = append(shares, append(append([]byte{}, s.y...), x))
+	}
+	secret, err := shamir.Combine(shares)
+	for _, s := range shares {
+		zeroBytes(s)
+	}
+	if err != nil {
+		return key, err
+	}
+	copy(key[:], secret)
+	zeroBytes(secret)
+	if !hmac.Equal(keyCheck(key), u.first.check) {
+		zeroBytes(key[:])
+		return key, ErrUnseal
+	}
+	return key, nil
+}
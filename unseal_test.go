@@ -0,0 +1,71 @@
+package svalkey
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnsealer(t *testing.T) {
+	shares, err := SplitKey(testSecret, 5, 3)
+	assert.Nil(t, err, "Err in SplitKey must be nil")
+	assert.Equal(t, 5, len(shares), "SplitKey must return n shares")
+
+	opened := 0
+	u, err := NewUnsealer(func(key [32]byte) (*Store, error) {
+		opened++
+		return NewCustomStore(NewMock(), JSONCodec{}, []byte{1, 0}, key)
+	})
+	assert.Nil(t, err, "Err in NewUnsealer must be nil")
+	st, err := u.Add(shares[4])
+	assert.Nil(t, err, "Err in Add must be nil")
+	assert.Nil(t, st, "Store must not be opened before threshold")
+	st, err = u.Add(shares[4])
+	assert.Nil(t, err, "Err in Add of duplicated share must be nil")
+	added, threshold := u.Progress()
+	assert.Equal(t, 1, added, "Duplicated share must be counted once")
+	assert.Equal(t, 3, threshold, "Threshold must be taken from shares")
+
+	corrupted := []byte(shares[1])
+	corrupted[20] ^= 1
+	_, err = u.Add(string(corrupted))
+	assert.Equal(t, ErrKeyShare, err, "Corrupted share must fail")
+	other, err := SplitKey([32]byte{1}, 5, 3)
+	assert.Nil(t, err, "Err in SplitKey must be nil")
+	_, err = u.Add(other[0])
+	assert.Equal(t, ErrShareMismatch, err, "Share of other key must fail")
+
+	_, err = u.Add(shares[0])
+	assert.Nil(t, err, "Err in Add must be nil")
+	st, err = u.Add(" " + shares[2] + "\n")
+	assert.Nil(t, err, "Err in Add must be nil")
+	assert.NotNil(t, st, "Store must be opened at threshold")
+	assert.Equal(t, testSecret, *st.key, "Store must be opened with master key")
+	assert.Equal(t, 1, opened, "Store must be opened once")
+	added, _ = u.Progress()
+	assert.Equal(t, 0, added, "Shares must be dropped after unseal")
+
+	key, err := CombineKeyShares([]string{shares[3], shares[1], shares[0], shares[2]})
+	assert.Nil(t, err, "Err in CombineKeyShares must be nil")
+	assert.Equal(t, testSecret, key, "CombineKeyShares must return master key")
+	_, err = CombineKeyShares(shares[:2])
+	assert.Equal(t, ErrUnseal, err, "Combine below threshold must fail")
+
+	_, err = SplitKey(testSecret, 2, 3)
+	assert.NotNil(t, err, "Err in SplitKey with threshold above shares must not be nil")
+}
+
+func TestUnsealer_NoOpen(t *testing.T) {
+	shares, err := SplitKey(testSecret, 3, 2)
+	assert.Nil(t, err, "Err in SplitKey must be nil")
+
+	_, err = NewUnsealer(nil)
+	assert.Equal(t, ErrNoOpen, err, "NewUnsealer without open must fail")
+	u := &Unsealer{}
+	for _, share := range shares {
+		_, err = u.Add(share)
+		assert.Equal(t, ErrNoOpen, err, "Add to Unsealer without open must fail")
+	}
+	added, _ := u.Progress()
+	assert.Equal(t, 0, added, "Shares must not be added to Unsealer without open")
+}
@@ -0,0 +1,181 @@
+package svalkey
+
+import (
+	"bytes"
+	"io/ioutil"
+	"sort"
+
+	"github.com/abronan/valkeyrie/store"
+	"github.com/minio/sio"
+)
+
+// VerifyStatus is the result of an entry check
+type VerifyStatus string
+
+// Verify statuses
+const (
+	// VerifyOK means the value is authentic and readable
+	VerifyOK VerifyStatus = "ok"
+	// VerifyLegacy means the value is authentic but has
+	// legacy format without envelope header
+	VerifyLegacy VerifyStatus = "legacy-format"
+	// VerifyUnreadable means the value is malformed, truncated
+	// or some of its chunks are missing or corrupted
+	VerifyUnreadable VerifyStatus = "unreadable"
+	// VerifyWrongKey means the value can't be authenticated with the
+	// Store key: it was encrypted with other key or tampered with
+	VerifyWrongKey VerifyStatus = "wrong-key"
+	// VerifyDecodeFailed means the value is authentic but the codec
+	// can't decode it
+	VerifyDecodeFailed VerifyStatus = "decode-failed"
+	// VerifyOrphanedChunk means the chunk doesn't belong to any value
+	VerifyOrphanedChunk VerifyStatus = "orphaned-chunk"
+)
+
+// VerifyOptions holds Verify settings
+type VerifyOptions struct {
+	// NewValue returns a pointer to a value of key's type.
+	// If it is set Verify tries to decode values with the codec
+	NewValue func(key string) interface{}
+}
+
+// VerifyEntry holds check result of one entry
+type VerifyEntry struct {
+	Key    string       `json:"key"`
+	Status VerifyStatus `json:"status"`
+	Error  string       `json:"error,omitempty"`
+}
+
+// VerifyReport holds Verify result
+type VerifyReport struct {
+	Entries []VerifyEntry        `json:"entries"`
+	Counts  map[VerifyStatus]int `json:"counts"`
+}
+
+// OK reports whether all entries are readable
+func (r *VerifyReport) OK() bool {
+	for _, e := range r.Entries {
+		if e.Status != VerifyOK && e.Status != VerifyLegacy {
+			return false
+		}
+	}
+	return true
+}
+
+// Verify walks every entry under prefix, checks value envelope,
+// authenticates values with the Store key and optionally decodes
+// them. Chunks which don't belong to any value are reported as
+// orphaned. Verify doesn't modify the store. It runs as OpVerify
+// operation with the keys of values, so Policy requires read
+// capability on every one of them
+func (s *Store) Verify(prefix string, opts *VerifyOptions) (*VerifyReport, error) {
+	if opts == nil {
+		opts = &VerifyOptions{}
+	}
+	prefix, err := s.scope(prefix)
+	if err != nil {
+		return nil, err
+	}
+	pairs, err := s.list(prefix, nil)
+	if err != nil && err != store.ErrKeyNotFound {
+		return nil, err
+	}
+	keys := []string{}
+	for _, p := range pairs {
+		if !isChunkKey(p.Key) && !isReservedKey(p.Key) {
+			keys = append(keys, p.Key)
+		}
+	}
+	var rep *VerifyReport
+	err = s.run(&Operation{Name: OpVerify, Key: prefix, Keys: keys}, func(op *Operation) error {
+		rep = s.verifyPairs(pairs, opts)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rep, nil
+}
+
+func (s *Store) verifyPairs(pairs []*store.KVPair, opts *VerifyOptions) *VerifyReport {
+	rep := &VerifyReport{
+		Entries: []VerifyEntry{},
+		Counts:  map[VerifyStatus]int{},
+	}
+	chunks := map[string]bool{}
+	for _, p := range pairs {
+		if isChunkKey(p.Key) {
+			continue
+		}
+		if isManifest(p.Value) {
+			if m, err := s.unmarshalManifest(p.Key, p.Value); err == nil {
+				for i := range m.hashes {
+					chunks[chunkKey(p.Key, m.gen, i)] = true
+				}
+			}
+		}
+		rep.add(s.verifyValue(p, opts))
+	}
+	for _, p := range pairs {
+		if isChunkKey(p.Key) && !chunks[p.Key] {
+			rep.add(VerifyEntry{Key: p.Key, Status: VerifyOrphanedChunk})
+		}
+	}
+	sort.Slice(rep.Entries, func(i, j int) bool {
+		return rep.Entries[i].Key < rep.Entries[j].Key
+	})
+	return rep
+}
+
+func (r *VerifyReport) add(e VerifyEntry) {
+	r.Entries = append(r.Entries, e)
+	r.Counts[e.Status]++
+}
+
+func (s *Store) verifyValue(p *store.KVPair, opts *VerifyOptions) VerifyEntry {
+	fail := func(status VerifyStatus, err error) VerifyEntry {
+		return VerifyEntry{Key: p.Key, Status: status, Error: err.Error()}
+	}
+	data := p.Value
+	if isManifest(data) {
+		var err error
+		data, err = s.readChunks(p.Key, data, nil)
+		if err == ErrManifestCorrupted {
+			return fail(VerifyWrongKey, err)
+		}
+		if err != nil {
+			return fail(VerifyUnreadable, err)
+		}
+	}
+	decrypted, h, err := s.decryptReader(bytes.NewReader(data), s.key[:])
+	if err != nil {
+		if ErrorClass(err) == ErrClassAuthentication {
+			return fail(VerifyWrongKey, err)
+		}
+		return fail(VerifyUnreadable, err)
+	}
+	plain, err := ioutil.ReadAll(decrypted)
+	defer zeroBytes(plain)
+	if err != nil {
+		if isAuthError(err) {
+			return fail(VerifyWrongKey, err)
+		}
+		return fail(VerifyUnreadable, err)
+	}
+	if opts.NewValue != nil && !isReservedKey(p.Key) {
+		if _, err := s.decodePlain(bytes.NewReader(plain), h, opts.NewValue(p.Key)); err != nil {
+			return fail(VerifyDecodeFailed, err)
+		}
+	}
+	if h.legacy {
+		return VerifyEntry{Key: p.Key, Status: VerifyLegacy}
+	}
+	return VerifyEntry{Key: p.Key, Status: VerifyOK}
+}
+
+// isAuthError reports whether err is DARE error: the value
+// is not authentic or malformed, so it fails authentication
+func isAuthError(err error) bool {
+	_, ok := err.(sio.Error)
+	return ok
+}
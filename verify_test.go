@@ -0,0 +1,85 @@
+package svalkey
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+	"testing"
+
+	"github.com/minio/sio"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/hkdf"
+)
+
+// legacyValue encrypts plain in the format used before value envelope
+func legacyValue(t *testing.T, plain []byte) []byte {
+	var nonce, dkey [32]byte
+	rand.Read(nonce[:])
+	io.ReadFull(hkdf.New(sha256.New, testSecret[:], nonce[:], nil), dkey[:])
+	out := bytes.NewBuffer(nonce[:])
+	_, err := sio.Encrypt(out, bytes.NewReader(plain), sio.Config{Key: dkey[:]})
+	assert.Nil(t, err, "Err in Encrypt must be nil")
+	return out.Bytes()
+}
+
+func TestStore_Verify(t *testing.T) {
+	st, m := newChunkedStore(t)
+	big := make([]byte, 1000)
+	rand.Read(big)
+	assert.Nil(t, st.Put("app/big", big, nil), "Err in Put must be nil")
+	assert.Nil(t, st.Put("app/ok", TestType{C: "ok"}, nil), "Err in Put must be nil")
+	assert.Nil(t, st.Put("app/str", "text", nil), "Err in Put must be nil")
+	m.kv["app/legacy"] = legacyValue(t, []byte(`{"C":"legacy"}`))
+
+	rep, err := st.Verify("app", nil)
+	assert.Nil(t, err, "Err in Verify must be nil")
+	assert.True(t, rep.OK(), "Report must be OK")
+	assert.Equal(t, 3, rep.Counts[VerifyOK])
+	assert.Equal(t, 1, rep.Counts[VerifyLegacy])
+
+	other, err := NewCustomStore(NewMock(), JSONCodec{}, []byte{1, 0}, [32]byte{1})
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	assert.Nil(t, other.Put("x", "other", nil), "Err in Put must be nil")
+	m.kv["app/wrongkey"] = other.Store.(*Mock).kv["x"]
+	other.SetRecipients(SymmetricRecipient([32]byte{2}))
+	assert.Nil(t, other.Put("y", "other", nil), "Err in Put must be nil")
+	m.kv["app/notrecipient"] = other.Store.(*Mock).kv["y"]
+	m.kv["app/garbage"] = []byte("garbage")
+	m.kv["app/orphan/_chunks/0"] = []byte("chunk")
+	m.kv["app/big/_chunks/99"] = []byte("chunk")
+	delete(m.kv, storedChunkKey(st, "app/big", 1))
+
+	rep, err = st.Verify("app", &VerifyOptions{
+		NewValue: func(string) interface{} { return &TestType{} },
+	})
+	assert.Nil(t, err, "Err in Verify must be nil")
+	assert.False(t, rep.OK(), "Report must not be OK")
+	status := map[string]VerifyStatus{}
+	for _, e := range rep.Entries {
+		status[e.Key] = e.Status
+	}
+	assert.Equal(t, map[string]VerifyStatus{
+		"app/big":              VerifyUnreadable,
+		"app/big/_chunks/99":   VerifyOrphanedChunk,
+		"app/garbage":          VerifyUnreadable,
+		"app/legacy":           VerifyLegacy,
+		"app/notrecipient":     VerifyWrongKey,
+		"app/ok":               VerifyOK,
+		"app/orphan/_chunks/0": VerifyOrphanedChunk,
+		"app/str":              VerifyDecodeFailed,
+		"app/wrongkey":         VerifyWrongKey,
+	}, status)
+}
+
+func TestIsAuthError(t *testing.T) {
+	key := make([]byte, 32)
+	data := &bytes.Buffer{}
+	_, err := sio.Encrypt(data, bytes.NewReader([]byte("value")), sio.Config{Key: key})
+	assert.Nil(t, err, "Err in Encrypt must be nil")
+	_, err = sio.Decrypt(&bytes.Buffer{}, bytes.NewReader(data.Bytes()),
+		sio.Config{Key: bytes.Repeat([]byte{1}, 32)})
+	assert.True(t, isAuthError(err), "Wrong key must be authentication error")
+	assert.False(t, isAuthError(io.ErrUnexpectedEOF), "Other errors must not be authentication error")
+	assert.False(t, isAuthError(nil), "Nil must not be authentication error")
+}
@@ -0,0 +1,275 @@
+package svalkey
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/abronan/valkeyrie/store"
+)
+
+// ErrInvalidPath represents invalid key path, path with
+// reserved _chunks or _svalkey segment or path outside
+// of View root error
+var ErrInvalidPath = fmt.Errorf("svalkey: in View" +
+	" key path is invalid or outside of namespace root")
+
+// View is a SecureStore restricted to keys under its root.
+// Keys passed to View are relative to the root: they are
+// normalised (leading, repeated slashes and "." segments are
+// dropped) and rejected if they hold ".." or reserved "_svalkey"
+// and "_chunks" segments. List returns keys relative to the root
+type View struct {
+	s    SecureStore
+	root string
+}
+
+var _ SecureStore = (*View)(nil)
+
+// Namespace returns View of s with root
+func (s *Store) Namespace(root string) (*View, error) {
+	return newView(s, root)
+}
+
+// Namespace returns View of c with root, reads of the View
+// are cached by c
+func (c *CachedStore) Namespace(root string) (*View, error) {
+	return newView(c, root)
+}
+
+// Namespace returns View of v with root under the root of v
+func (v *View) Namespace(root string) (*View, error) {
+	root, err := v.dir(root)
+	if err != nil || root == v.root {
+		return nil, ErrInvalidPath
+	}
+	return &View{s: v.s, root: root}, nil
+}
+
+func newView(s SecureStore, root string) (*View, error) {
+	root, err := cleanPath(root)
+	if err != nil || root == "" {
+		return nil, ErrInvalidPath
+	}
+	return &View{s: s, root: strings.TrimSuffix(root, "/") + "/"}, nil
+}
+
+// Root returns the root of v terminated with slash
+func (v *View) Root() string {
+	return v.root
+}
+
+// cleanPath normalises key path keeping its trailing slash
+func cleanPath(p string) (string, error) {
+	parts := strings.Split(p, "/")
+	out := make([]string, 0, len(parts))
+	for _, part := range parts {
+		switch part {
+		case "", ".":
+			continue
+		case "..", strings.TrimSuffix(reservedPrefix, "/"),
+			strings.Trim(chunksDir, "/"):
+			return "", ErrInvalidPath
+		}
+		out = append(out, part)
+	}
+	clean := strings.Join(out, "/")
+	if clean != "" && strings.HasSuffix(p, "/") {
+		clean += "/"
+	}
+	return clean, nil
+}
+
+// key returns full key of value key path p
+func (v *View) key(p string) (string, error) {
+	clean, err := cleanPath(p)
+	if err != nil || clean == "" || strings.HasSuffix(clean, "/") {
+		return "", ErrInvalidPath
+	}
+	return v.root + clean, nil
+}
+
+// dir returns full directory of path p, empty p is the root
+func (v *View) dir(p string) (string, error) {
+	clean, err := cleanPath(p)
+	if err != nil {
+		return "", err
+	}
+	if clean != "" && !strings.HasSuffix(clean, "/") {
+		clean += "/"
+	}
+	return v.root + clean, nil
+}
+
+func (v *View) keys(paths []string) ([]string, error) {
+	keys := make([]string, len(paths))
+	for i, p := range paths {
+		key, err := v.key(p)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = key
+	}
+	return keys, nil
+}
+
+// Put a value at the specified key path
+func (v *View) Put(key string, value interface{},
+	options *store.WriteOptions) error {
+	key, err := v.key(key)
+	if err != nil {
+		return err
+	}
+	return v.s.Put(key, value, options)
+}
+
+// Get a value given its key path
+func (v *View) Get(key string, value interface{},
+	options *store.ReadOptions) error {
+	key, err := v.key(key)
+	if err != nil {
+		return err
+	}
+	return v.s.Get(key, value, options)
+}
+
+// PutBytes puts value at the specified key path
+func (v *View) PutBytes(key string, value []byte,
+	options *store.WriteOptions) error {
+	key, err := v.key(key)
+	if err != nil {
+		return err
+	}
+	return v.s.PutBytes(key, value, options)
+}
+
+// GetBytes gets a value put with PutBytes or PutStream
+func (v *View) GetBytes(key string,
+	options *store.ReadOptions) ([]byte, error) {
+	key, err := v.key(key)
+	if err != nil {
+		return nil, err
+	}
+	return v.s.GetBytes(key, options)
+}
+
+// PutStream puts data read from r at the specified key path
+func (v *View) PutStream(key string, r io.Reader,
+	options *store.WriteOptions) error {
+	key, err := v.key(key)
+	if err != nil {
+		return err
+	}
+	return v.s.PutStream(key, r, options)
+}
+
+// GetStream returns reader of the value at the specified key path
+func (v *View) GetStream(key string,
+	options *store.ReadOptions) (io.ReadCloser, error) {
+	key, err := v.key(key)
+	if err != nil {
+		return nil, err
+	}
+	return v.s.GetStream(key, options)
+}
+
+// Delete the value at the specified key path
+func (v *View) Delete(key string) error {
+	key, err := v.key(key)
+	if err != nil {
+		return err
+	}
+	return v.s.Delete(key)
+}
+
+// Exists verifies if a key path exists in the store
+func (v *View) Exists(key string, options *store.ReadOptions) (bool, error) {
+	key, err := v.key(key)
+	if err != nil {
+		return false, err
+	}
+	return v.s.Exists(key, options)
+}
+
+// List the content of a given directory, empty directory
+// is the root. Keys of pairs are relative to the root
+func (v *View) List(directory string, value interface{},
+	options *store.ReadOptions) ([]*ListPair, error) {
+	directory, err := v.dir(directory)
+	if err != nil {
+		return nil, err
+	}
+	pairs, err := v.s.List(directory, value, options)
+	if err != nil {
+		return nil, err
+	}
+	for i, p := range pairs {
+		pairs[i] = &ListPair{
+			key:   strings.TrimPrefix(strings.TrimLeft(p.key, "/"), v.root),
+			value: p.value,
+		}
+	}
+	return pairs, nil
+}
+
+// DeleteTree deletes a range of keys under a given directory.
+// Empty directory is rejected, the root can't be deleted
+// with View
+func (v *View) DeleteTree(directory string) error {
+	directory, err := v.dir(directory)
+	if err != nil {
+		return err
+	}
+	if directory == v.root {
+		return ErrInvalidPath
+	}
+	return v.s.DeleteTree(directory)
+}
+
+// relative converts keys of BatchError to paths relative to the root
+func (v *View) relative(err error) error {
+	be, ok := err.(*BatchError)
+	if !ok {
+		return err
+	}
+	errs := make(map[string]error, len(be.Errors))
+	for key, err := range be.Errors {
+		errs[strings.TrimPrefix(strings.TrimLeft(key, "/"), v.root)] = err
+	}
+	return &BatchError{Errors: errs}
+}
+
+// GetMany gets values of key paths into out, see Store.GetMany
+func (v *View) GetMany(keys []string, out interface{}, opts *BatchOptions) error {
+	keys, err := v.keys(keys)
+	if err != nil {
+		return err
+	}
+	return v.relative(v.s.GetMany(keys, out, opts))
+}
+
+// PutMany puts values at their key paths, see Store.PutMany
+func (v *View) PutMany(values map[string]interface{}, opts *BatchOptions) error {
+	full := make(map[string]interface{}, len(values))
+	for p, value := range values {
+		key, err := v.key(p)
+		if err != nil {
+			return err
+		}
+		full[key] = value
+	}
+	return v.relative(v.s.PutMany(full, opts))
+}
+
+// DeleteMany deletes values at key paths, see Store.DeleteMany
+func (v *View) DeleteMany(keys []string, opts *BatchOptions) error {
+	keys, err := v.keys(keys)
+	if err != nil {
+		return err
+	}
+	return v.relative(v.s.DeleteMany(keys, opts))
+}
+
+// Close does nothing, the underlying Store
+// is shared by its views and must be closed by its owner
+func (v *View) Close() {}
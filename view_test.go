@@ -0,0 +1,89 @@
+package svalkey
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/abronan/valkeyrie/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// dirMock lists and deletes only keys under directory
+type dirMock struct {
+	*Mock
+}
+
+func (m dirMock) List(directory string,
+	options *store.ReadOptions) ([]*store.KVPair, error) {
+	pairs, err := m.Mock.List(directory, options)
+	ret := []*store.KVPair{}
+	for _, p := range pairs {
+		if strings.HasPrefix(p.Key, directory) {
+			ret = append(ret, p)
+		}
+	}
+	return ret, err
+}
+
+func (m dirMock) DeleteTree(directory string) error {
+	m.Lock()
+	defer m.Unlock()
+	for k := range m.kv {
+		if strings.HasPrefix(k, directory) {
+			delete(m.kv, k)
+		}
+	}
+	return nil
+}
+
+func TestStore_Namespace(t *testing.T) {
+	m := NewMock()
+	st, err := NewCustomStore(dirMock{m}, JSONCodec{}, []byte{1, 0}, testSecret)
+	assert.Nil(t, err, "Err in NewCustomStore must be nil")
+	assert.Nil(t, st.Put("svc/other/db", TestType{C: "other"}, nil), "Err in Put must be nil")
+	v, err := st.Namespace("/svc//payments")
+	assert.Nil(t, err, "Err in Namespace must be nil")
+	assert.Equal(t, "svc/payments/", v.Root(), "Root must be normalised")
+
+	assert.Nil(t, v.Put("db", TestType{C: "db"}, nil), "Err in Put must be nil")
+	assert.Contains(t, m.kv, "svc/payments/db", "Key must be prefixed with root")
+	assert.Nil(t, v.Put("/keys//./api", TestType{C: "api"}, nil), "Err in Put must be nil")
+	assert.Contains(t, m.kv, "svc/payments/keys/api", "Key must be normalised")
+	out := TestType{}
+	assert.Nil(t, v.Get("keys/api", &out, nil), "Err in Get must be nil")
+	assert.Equal(t, "api", out.C, "Get must return put value")
+
+	for _, key := range []string{"", "/", "../other/db", "a/../../other/db",
+		"_svalkey/primers/x", "db/_chunks/0", "dir/"} {
+		assert.Equal(t, ErrInvalidPath, v.Get(key, &out, nil), "Get of %q must fail", key)
+	}
+	assert.Equal(t, ErrInvalidPath, v.DeleteTree(""), "DeleteTree of root must fail")
+	assert.Equal(t, ErrInvalidPath, v.DeleteTree("/"), "DeleteTree of root must fail")
+
+	list := []TestType{}
+	pairs, err := v.List("", &list, nil)
+	assert.Nil(t, err, "Err in List must be nil")
+	keys := []string{}
+	for _, p := range pairs {
+		keys = append(keys, p.Key())
+	}
+	assert.ElementsMatch(t, []string{"db", "keys/api"}, keys, "List keys must be relative to root")
+
+	err = v.GetMany([]string{"db", "missing"}, &list, nil)
+	be, ok := err.(*BatchError)
+	assert.True(t, ok, "Err in GetMany must be BatchError")
+	assert.Contains(t, be.Errors, "missing", "BatchError keys must be relative to root")
+
+	sub, err := v.Namespace("keys")
+	assert.Nil(t, err, "Err in Namespace must be nil")
+	assert.Equal(t, "svc/payments/keys/", sub.Root(), "Nested root must be under parent root")
+	assert.Nil(t, sub.Get("api", &out, nil), "Err in Get must be nil")
+	_, err = v.Namespace("..")
+	assert.Equal(t, ErrInvalidPath, err, "Namespace outside of root must fail")
+	_, err = st.Namespace("")
+	assert.Equal(t, ErrInvalidPath, err, "Empty root must fail")
+
+	assert.Nil(t, v.DeleteTree("keys"), "Err in DeleteTree must be nil")
+	assert.NotContains(t, m.kv, "svc/payments/keys/api", "DeleteTree must delete directory")
+	assert.Contains(t, m.kv, "svc/other/db", "DeleteTree must not delete outside of root")
+}